@@ -0,0 +1,208 @@
+package tcr
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultAdaptiveMinPrefetch     = 1
+	defaultAdaptiveMaxPrefetch     = 500
+	defaultAdaptiveTargetLatency   = time.Duration(1000) * time.Millisecond
+	defaultAdaptiveAdjustInterval  = time.Duration(5000) * time.Millisecond
+	adaptivePrefetchSaturatedRatio = 0.75 // share of the prefetch in flight before it's worth growing
+)
+
+// adaptivePrefetch tunes the prefetch of a Consumer between bounds. Every interval it halves the prefetch when the
+// average latency from delivery to settlement exceeds the target, and grows it by a quarter when the latency is under
+// half the target while the in-flight deliveries used most of the prefetch. Otherwise the prefetch is kept.
+type adaptivePrefetch struct {
+	min          int
+	max          int
+	target       time.Duration
+	interval     time.Duration
+	current      int
+	inFlight     int
+	generation   int // bumped when the channel is lost, along with its unsettled deliveries
+	peakInFlight int
+	latencySum   time.Duration
+	settled      int
+	lastAdjusted time.Time
+	adaptiveLock *sync.Mutex
+}
+
+func newAdaptivePrefetch(config *AdaptiveQosConfig, initial int) *adaptivePrefetch {
+
+	adaptive := &adaptivePrefetch{
+		min:          defaultAdaptiveMinPrefetch,
+		max:          defaultAdaptiveMaxPrefetch,
+		target:       defaultAdaptiveTargetLatency,
+		interval:     defaultAdaptiveAdjustInterval,
+		lastAdjusted: time.Now(),
+		adaptiveLock: &sync.Mutex{},
+	}
+
+	if config.MinPrefetch > 0 {
+		adaptive.min = config.MinPrefetch
+	}
+	if config.MaxPrefetch > 0 {
+		adaptive.max = config.MaxPrefetch
+	}
+	if adaptive.max < adaptive.min {
+		adaptive.max = adaptive.min
+	}
+	if config.TargetLatency > 0 {
+		adaptive.target = time.Duration(config.TargetLatency) * time.Millisecond
+	}
+	if config.AdjustInterval > 0 {
+		adaptive.interval = time.Duration(config.AdjustInterval) * time.Millisecond
+	}
+
+	adaptive.current = adaptive.clamp(initial)
+
+	return adaptive
+}
+
+func (adaptive *adaptivePrefetch) clamp(prefetch int) int {
+
+	if prefetch < adaptive.min {
+		return adaptive.min
+	}
+	if prefetch > adaptive.max {
+		return adaptive.max
+	}
+
+	return prefetch
+}
+
+// prefetch returns the current prefetch.
+func (adaptive *adaptivePrefetch) prefetch() int {
+	adaptive.adaptiveLock.Lock()
+	defer adaptive.adaptiveLock.Unlock()
+
+	return adaptive.current
+}
+
+// track counts a delivery as in flight and returns the func settling it, only its first call counts.
+func (adaptive *adaptivePrefetch) track() func() {
+
+	adaptive.adaptiveLock.Lock()
+	adaptive.inFlight++
+	if adaptive.inFlight > adaptive.peakInFlight {
+		adaptive.peakInFlight = adaptive.inFlight
+	}
+	generation := adaptive.generation
+	adaptive.adaptiveLock.Unlock()
+
+	deliveredAt := time.Now()
+	var done int32
+	return func() {
+		if !atomic.CompareAndSwapInt32(&done, 0, 1) {
+			return
+		}
+
+		adaptive.adaptiveLock.Lock()
+		defer adaptive.adaptiveLock.Unlock()
+
+		if generation == adaptive.generation {
+			adaptive.inFlight--
+		}
+		adaptive.latencySum += time.Since(deliveredAt)
+		adaptive.settled++
+	}
+}
+
+// forget stops counting the deliveries in flight, they were requeued along with the lost channel.
+func (adaptive *adaptivePrefetch) forget() {
+	adaptive.adaptiveLock.Lock()
+	defer adaptive.adaptiveLock.Unlock()
+
+	adaptive.generation++
+	adaptive.inFlight = 0
+}
+
+// adjust recalculates the prefetch once the interval has passed since the last adjustment.
+// Returns true when the prefetch changed.
+func (adaptive *adaptivePrefetch) adjust(now time.Time) bool {
+	adaptive.adaptiveLock.Lock()
+	defer adaptive.adaptiveLock.Unlock()
+
+	if now.Sub(adaptive.lastAdjusted) < adaptive.interval {
+		return false
+	}
+
+	next := adaptive.current
+	if adaptive.settled > 0 {
+		latency := adaptive.latencySum / time.Duration(adaptive.settled)
+		saturated := float64(adaptive.peakInFlight) >= float64(adaptive.current)*adaptivePrefetchSaturatedRatio
+
+		switch {
+		case latency > adaptive.target:
+			next = adaptive.clamp(adaptive.current / 2)
+		case latency < adaptive.target/2 && saturated:
+			growth := adaptive.current / 4
+			if growth < 1 {
+				growth = 1
+			}
+			next = adaptive.clamp(adaptive.current + growth)
+		}
+	}
+
+	adaptive.lastAdjusted = now
+	adaptive.latencySum = 0
+	adaptive.settled = 0
+	adaptive.peakInFlight = adaptive.inFlight
+
+	if next == adaptive.current {
+		return false
+	}
+
+	adaptive.current = next
+	return true
+}
+
+// UseAdaptiveQos tunes the prefetch within the AdaptiveQosConfig bounds, starting from the QosCountOverride.
+// Overrides the ConsumerConfig AdaptiveQosConfig, nil or disabled keeps the QosCountOverride. Set it before starting
+// to consume. Only ackable deliveries are measured, auto acknowledged subscriptions aren't limited by a prefetch.
+func (con *Consumer) UseAdaptiveQos(config *AdaptiveQosConfig) {
+	con.conLock.Lock()
+	defer con.conLock.Unlock()
+
+	con.adaptive = nil
+	if config != nil && config.Enabled {
+		con.adaptive = newAdaptivePrefetch(config, con.qosCountOverride)
+	}
+}
+
+// Prefetch returns the prefetch (basic.qos count) the Consumer subscribes with, as tuned by the AdaptiveQosConfig
+// when enabled, otherwise the QosCountOverride. Zero when the server default applies.
+func (con *Consumer) Prefetch() int {
+
+	if con.adaptive != nil {
+		return con.adaptive.prefetch()
+	}
+
+	return con.qosCountOverride
+}
+
+// trackPrefetch has the delivery of an ackable message count towards the adaptive prefetch until it's settled.
+func (con *Consumer) trackPrefetch(msg *ReceivedMessage) {
+
+	if con.adaptive != nil && msg.IsAckable {
+		msg.onSettle = con.adaptive.track()
+	}
+}
+
+// forgetInFlight stops counting unsettled deliveries towards the adaptive prefetch once their channel is lost.
+func (con *Consumer) forgetInFlight() {
+
+	if con.adaptive != nil {
+		con.adaptive.forget()
+	}
+}
+
+// adaptPrefetch returns true when the adaptive prefetch changed, it only applies to a new subscription.
+func (con *Consumer) adaptPrefetch() bool {
+	return con.adaptive != nil && con.adaptive.adjust(time.Now())
+}
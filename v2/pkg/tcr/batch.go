@@ -0,0 +1,251 @@
+package tcr
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultBatchSize   = 100
+	defaultBatchWindow = time.Duration(1000) * time.Millisecond
+)
+
+// BatchHandler processes a batch of messages, returning an error nacks the whole batch.
+type BatchHandler func(batch []*ReceivedMessage) error
+
+// consumeBatcher accumulates the messages of the consume loop, it's only touched by that goroutine.
+type consumeBatcher struct {
+	con     *Consumer
+	handler BatchHandler
+	size    int
+	window  time.Duration
+	requeue bool
+	batch   []*ReceivedMessage
+	started time.Time
+
+	settledUpTo uint64             // every delivery up to this tag on the channel is settled
+	settledTags map[uint64]bool    // tags past settledUpTo settled by the batcher
+	delivered   []*ReceivedMessage // ackable messages past settledUpTo, batched or settled elsewhere
+}
+
+// StartConsumingBatches starts the Consumer handing batches of up to BatchConfig Size messages to the handler, or fewer
+// once the BatchConfig Window has passed since the first of them arrived. Ackable batches are acked when the handler
+// succeeds, or nacked when it fails (the error is also sent to Errors). That's a single multiple acknowledgement when
+// every earlier delivery on the channel is settled, otherwise each message is settled on its own.
+// Keep the QosCountOverride at least the Size, otherwise batches only fill up as fast as the window allows.
+func (con *Consumer) StartConsumingBatches(handler BatchHandler) {
+
+	batcher := &consumeBatcher{
+		con:     con,
+		handler: handler,
+		size:    defaultBatchSize,
+		window:  defaultBatchWindow,
+	}
+
+	if config := con.Config.BatchConfig; config != nil {
+		if config.Size > 0 {
+			batcher.size = config.Size
+		}
+		if config.Window > 0 {
+			batcher.window = time.Duration(config.Window) * time.Millisecond
+		}
+		batcher.requeue = config.RequeueOnError
+	}
+
+	con.startConsuming(batcher.add, batcher)
+}
+
+func (batcher *consumeBatcher) add(msg *ReceivedMessage) {
+
+	if len(batcher.batch) == 0 {
+		batcher.started = time.Now()
+	}
+
+	batcher.batch = append(batcher.batch, msg)
+
+	if len(batcher.batch) >= batcher.size || time.Since(batcher.started) >= batcher.window {
+		batcher.flush()
+	}
+}
+
+func (batcher *consumeBatcher) flush() {
+
+	if len(batcher.batch) == 0 {
+		return
+	}
+
+	batch := batcher.batch
+	batcher.batch = nil
+
+	err := batcher.handler(batch)
+	if err != nil {
+		batcher.con.sendError(fmt.Errorf("batch handler failed on %d messages: %w", len(batch), err))
+	}
+
+	if batch[0].IsAckable {
+		if settleErr := batcher.settle(batch, err == nil); settleErr != nil {
+			batcher.con.sendError(settleErr)
+		}
+	}
+}
+
+// settle acks or nacks the batch with a single multiple acknowledgement up to its highest delivery tag, when every
+// delivery before it is either in the batch or already settled. Otherwise each message is settled on its own, a multiple
+// acknowledgement would also settle pending chunks or messages a middleware held back from the batch.
+func (batcher *consumeBatcher) settle(batch []*ReceivedMessage, ack bool) error {
+
+	tags := make(map[uint64]bool)
+	last := batch[0].Delivery
+	for _, msg := range batch {
+		for _, delivery := range msg.deliveries() {
+			tags[delivery.DeliveryTag] = true
+			if delivery.DeliveryTag > last.DeliveryTag {
+				last = delivery
+			}
+		}
+	}
+
+	if batcher.settledThrough(tags) < last.DeliveryTag {
+		for _, msg := range batch {
+			var err error
+			if ack {
+				err = msg.Acknowledge()
+			} else {
+				err = msg.Nack(batcher.requeue)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		batcher.markSettled(tags)
+		return nil
+	}
+
+	if !ack {
+		if err := last.Nack(true, batcher.requeue); err != nil {
+			return err
+		}
+
+		for _, msg := range batch {
+			msg.settle()
+		}
+
+		batcher.markSettled(tags)
+		return nil
+	}
+
+	if err := last.Ack(true); err != nil {
+		return err
+	}
+
+	for _, msg := range batch {
+		msg.acked()
+	}
+
+	batcher.markSettled(tags)
+	return nil
+}
+
+// deliver keeps track of an ackable message before it's handled, it might never join a batch.
+func (batcher *consumeBatcher) deliver(msg *ReceivedMessage) {
+
+	if msg.Delivery.DeliveryTag <= batcher.settledUpTo {
+		batcher.reset() // tags start over on a new channel
+	}
+
+	batcher.delivered = append(batcher.delivered, msg)
+}
+
+// settledThrough returns the highest tag up to which every delivery is settled, counting the given tags as settled.
+func (batcher *consumeBatcher) settledThrough(tags map[uint64]bool) uint64 {
+
+	settled := make(map[uint64]bool, len(tags)+len(batcher.settledTags))
+	for tag := range tags {
+		settled[tag] = true
+	}
+	for tag := range batcher.settledTags {
+		settled[tag] = true
+	}
+	for _, msg := range batcher.delivered {
+		if msg.Settled() {
+			for _, delivery := range msg.deliveries() {
+				settled[delivery.DeliveryTag] = true
+			}
+		}
+	}
+
+	through := batcher.settledUpTo
+	for settled[through+1] {
+		through++
+	}
+
+	return through
+}
+
+// markSettled records the settled tags and forgets what's settled up to the advanced settledUpTo.
+func (batcher *consumeBatcher) markSettled(tags map[uint64]bool) {
+
+	if batcher.settledTags == nil {
+		batcher.settledTags = make(map[uint64]bool)
+	}
+	for tag := range tags {
+		batcher.settledTags[tag] = true
+	}
+
+	batcher.settledUpTo = batcher.settledThrough(nil)
+
+	for tag := range batcher.settledTags {
+		if tag <= batcher.settledUpTo {
+			delete(batcher.settledTags, tag)
+		}
+	}
+
+	delivered := batcher.delivered[:0]
+	for _, msg := range batcher.delivered {
+		if !msg.Settled() || msg.Delivery.DeliveryTag > batcher.settledUpTo {
+			delivered = append(delivered, msg)
+		}
+	}
+	batcher.delivered = delivered
+}
+
+// reset forgets the batch and the settled deliveries of a closed channel.
+func (batcher *consumeBatcher) reset() {
+	batcher.batch = nil
+	batcher.settledUpTo = 0
+	batcher.settledTags = nil
+	batcher.delivered = nil
+}
+
+// flushBatch hands out the partial batch before stopping.
+func (con *Consumer) flushBatch() {
+
+	if con.batcher != nil {
+		con.batcher.flush()
+	}
+}
+
+// flushDueBatch hands out the partial batch once its window has passed.
+func (con *Consumer) flushDueBatch() {
+
+	if con.batcher != nil && len(con.batcher.batch) > 0 && time.Since(con.batcher.started) >= con.batcher.window {
+		con.batcher.flush()
+	}
+}
+
+// resetBatch drops the partial batch of a closed channel, its messages are redelivered on the next one.
+func (con *Consumer) resetBatch() {
+
+	if con.batcher != nil {
+		con.batcher.reset()
+	}
+}
+
+// deliverBatch lets the batcher know about an ackable delivery, whether or not it joins a batch.
+func (con *Consumer) deliverBatch(msg *ReceivedMessage) {
+
+	if con.batcher != nil && msg.IsAckable {
+		con.batcher.deliver(msg)
+	}
+}
@@ -0,0 +1,66 @@
+package tcr
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const maxResubscribeBackoff = time.Duration(30) * time.Second
+
+// ErrConsumerCanceled is sent to a Consumer's Errors when the server canceled its subscription (ex. the queue was
+// deleted, or a quorum queue changed leader) or its deliveries stopped. The Consumer resubscribes with backoff.
+var ErrConsumerCanceled = errors.New("consumer subscription was canceled")
+
+// canceled handles the delivery channel closing: settles what's held on the still open channel, which the consumer
+// keeps to subscribe on again, and reports the cancellation. A closed channel is returned to the pool instead,
+// canceled returns false then.
+func (con *Consumer) canceled(chanHost *ChannelHost) bool {
+
+	select {
+	case errorMessage := <-chanHost.Errors:
+		con.ConnectionPool.ReturnChannel(chanHost, true)
+		con.resetChunks()
+		con.resetBatch()
+		con.forgetInFlight()
+		if errorMessage != nil {
+			con.sendError(fmt.Errorf("consumer's current channel closed\r\n[reason: %s]\r\n[code: %d]", errorMessage.Reason, errorMessage.Code))
+		}
+		time.Sleep(con.resubscribeBackoff(1))
+		return false
+	default:
+	}
+
+	reason := "its deliveries closed"
+	select {
+	case tag := <-chanHost.Cancellations:
+		reason = fmt.Sprintf("the server canceled consumer tag %q", tag)
+	default:
+	}
+
+	con.flushBatch()
+	con.rejectChunks()
+
+	con.sendError(fmt.Errorf("%w: consumer %s on queue %s, %s", ErrConsumerCanceled, con.ConsumerName, con.QueueName, reason))
+	time.Sleep(con.resubscribeBackoff(1))
+	return true
+}
+
+// resubscribeBackoff doubles the SleepOnErrorInterval (or 100ms) for every failed attempt, up to 30s.
+func (con *Consumer) resubscribeBackoff(attempts int) time.Duration {
+
+	backoff := con.sleepOnErrorInterval
+	if backoff <= 0 {
+		backoff = defaultGetPollInterval
+	}
+
+	for i := 1; i < attempts && backoff < maxResubscribeBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > maxResubscribeBackoff {
+		backoff = maxResubscribeBackoff
+	}
+
+	return backoff
+}
@@ -3,6 +3,7 @@ package tcr
 import (
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/streadway/amqp"
 )
@@ -16,8 +17,10 @@ type ChannelHost struct {
 	CachedChannel bool
 	Confirmations chan amqp.Confirmation
 	Errors        chan *amqp.Error
+	Cancellations chan string // consumer tags canceled by the server
 	connHost      *ConnectionHost
 	chanLock      *sync.Mutex
+	lastUsed      time.Time
 }
 
 // NewChannelHost creates a simple ChannelHost wrapper for management by end-user developer.
@@ -76,6 +79,9 @@ func (ch *ChannelHost) MakeChannel() (err error) {
 	ch.Errors = make(chan *amqp.Error, 100)
 	ch.Channel.NotifyClose(ch.Errors)
 
+	ch.Cancellations = make(chan string, 100)
+	ch.Channel.NotifyCancel(ch.Cancellations)
+
 	return nil
 }
 
@@ -100,6 +106,20 @@ func (ch *ChannelHost) FlushConfirms() {
 	}
 }
 
+// FlushCancellations removes all previous consumer cancellations, ex. from an earlier consumer of a cached channel.
+func (ch *ChannelHost) FlushCancellations() {
+	ch.chanLock.Lock()
+	defer ch.chanLock.Unlock()
+
+	for {
+		select {
+		case <-ch.Cancellations:
+		default:
+			return
+		}
+	}
+}
+
 // PauseForFlowControl allows you to wait and sleep while receiving flow control messages.
 func (ch *ChannelHost) PauseForFlowControl() {
 
@@ -0,0 +1,419 @@
+package tcr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	// ChunkIDHeader holds the LetterID shared by every chunk of a split letter.
+	ChunkIDHeader = "x-tcr-chunk-id"
+	// ChunkIndexHeader holds the zero based position of the chunk.
+	ChunkIndexHeader = "x-tcr-chunk-index"
+	// ChunkCountHeader holds the total count of chunks.
+	ChunkCountHeader = "x-tcr-chunk-count"
+
+	defaultChunkSize          = 512 * 1024
+	defaultReassemblyTimeout  = time.Duration(60000) * time.Millisecond
+	defaultMaxReassemblyBytes = 64 * 1024 * 1024
+)
+
+// ErrReassemblyOverflow is returned when the chunks of a letter don't fit in the reassembly memory.
+var ErrReassemblyOverflow = errors.New("chunked letter doesn't fit in the reassembly memory")
+
+// SplitLetter splits the body of the letter into chunk letters of up to chunkSize bytes, in order.
+// Every chunk keeps the Envelope of the letter (and its LetterID) with the chunk headers added.
+// The CorrelationID is shared by every chunk, defaulting to the LetterID.
+// Letters not over the chunkSize are returned as is.
+func SplitLetter(letter *Letter, chunkSize int) []*Letter {
+
+	if chunkSize <= 0 || len(letter.Body) <= chunkSize {
+		return []*Letter{letter}
+	}
+
+	count := (len(letter.Body) + chunkSize - 1) / chunkSize
+	chunks := make([]*Letter, 0, count)
+	for index := 0; index < count; index++ {
+		end := (index + 1) * chunkSize
+		if end > len(letter.Body) {
+			end = len(letter.Body)
+		}
+
+		envelope := *letter.Envelope
+		envelope.Headers = make(map[string]interface{}, len(letter.Envelope.Headers)+3)
+		for name, value := range letter.Envelope.Headers {
+			envelope.Headers[name] = value
+		}
+		envelope.Headers[ChunkIDHeader] = letter.LetterID.String()
+		envelope.Headers[ChunkIndexHeader] = int64(index)
+		envelope.Headers[ChunkCountHeader] = int64(count)
+
+		if envelope.CorrelationID == "" {
+			envelope.CorrelationID = letter.LetterID.String()
+		}
+
+		chunks = append(chunks, &Letter{
+			LetterID:   letter.LetterID,
+			RetryCount: letter.RetryCount,
+			Body:       letter.Body[index*chunkSize : end],
+			Envelope:   &envelope,
+		})
+	}
+
+	return chunks
+}
+
+// UseChunking splits letters with a body over chunkSize bytes into chunk messages on every publish path, zero disables it.
+// The chunks of a letter are always published together with confirmation, even by Publish, and succeed or fail as one.
+// They're published on a transient confirm channel opened for the letter, leaving the pooled channels untouched.
+func (pub *Publisher) UseChunking(chunkSize int) {
+	pub.pubLock.Lock()
+	defer pub.pubLock.Unlock()
+
+	pub.chunkSize = chunkSize
+}
+
+// splitLetter returns the chunks of the letter when over the chunk size, nil when it isn't chunked.
+func (pub *Publisher) splitLetter(letter *Letter) []*Letter {
+
+	pub.pubLock.Lock()
+	chunkSize := pub.chunkSize
+	pub.pubLock.Unlock()
+
+	if chunkSize <= 0 || len(letter.Body) <= chunkSize {
+		return nil
+	}
+
+	return SplitLetter(letter, chunkSize)
+}
+
+// publishChunked publishes the letter as chunks when over the chunk size, returns false when it isn't chunked.
+func (pub *Publisher) publishChunked(ctx context.Context, letter *Letter, timeout time.Duration) (bool, error) {
+
+	chunks := pub.splitLetter(letter)
+	if chunks == nil {
+		return false, nil
+	}
+
+	return true, pub.publishChunks(ctx, chunks, timeout)
+}
+
+// publishChunks publishes the chunks under one confirm batch on a transient channel, waiting for every confirmation
+// until the context is done or the timeout expires. A zero timeout uses the Publisher's, a negative one only the context.
+func (pub *Publisher) publishChunks(ctx context.Context, chunks []*Letter, timeout time.Duration) error {
+
+	if timeout == 0 {
+		timeout = pub.publishTimeOutDuration
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	channel := pub.ConnectionPool.GetTransientChannel(true)
+	defer func() {
+		defer func() {
+			_ = recover()
+		}()
+		channel.Close()
+	}()
+
+	confirms := channel.NotifyPublish(make(chan amqp.Confirmation, len(chunks)))
+
+	for _, chunk := range chunks {
+		err := channel.Publish(
+			chunk.Envelope.Exchange,
+			chunk.Envelope.RoutingKey,
+			chunk.Envelope.Mandatory,
+			chunk.Envelope.Immediate,
+			pub.createPublishing(chunk),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for confirmed := 0; confirmed < len(chunks); confirmed++ {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: LetterID %s (%d of %d chunks confirmed)", ErrPublishTimeout, chunks[0].LetterID.String(), confirmed, len(chunks))
+
+		case confirmation, ok := <-confirms:
+			if !ok {
+				return errors.New("channel closed before the chunks were confirmed")
+			}
+
+			if !confirmation.Ack {
+				return fmt.Errorf("%w: chunk %d of LetterID %s", ErrPublishNacked, confirmation.DeliveryTag-1, chunks[0].LetterID.String())
+			}
+		}
+	}
+
+	return nil
+}
+
+// Reassembler holds the chunks of split letters until every one of them is received, within a timeout
+// and a cap on the bytes held. Consumers sharing a queue should be given their own Reassembler, and
+// need a prefetch (QOSCountOverride) larger than the chunk count so every chunk can be delivered.
+type Reassembler struct {
+	timeout  time.Duration
+	maxBytes int
+	bytes    int
+	pending  map[string]*chunkSet
+	lock     *sync.Mutex
+}
+
+// chunkSet is the chunks received so far for one letter.
+type chunkSet struct {
+	chunks   []*ReceivedMessage
+	received int
+	bytes    int
+	started  time.Time
+}
+
+// NewReassembler creates a Reassembler from the ChunkingConfig.
+func NewReassembler(config *ChunkingConfig) *Reassembler {
+
+	reassembler := &Reassembler{
+		timeout:  defaultReassemblyTimeout,
+		maxBytes: defaultMaxReassemblyBytes,
+		pending:  make(map[string]*chunkSet),
+		lock:     &sync.Mutex{},
+	}
+
+	if config != nil {
+		if config.ReassemblyTimeout > 0 {
+			reassembler.timeout = time.Duration(config.ReassemblyTimeout) * time.Millisecond
+		}
+		if config.MaxReassemblyBytes > 0 {
+			reassembler.maxBytes = config.MaxReassemblyBytes
+		}
+	}
+
+	return reassembler
+}
+
+// Add takes a received message and returns the reassembled message once its last chunk is added, nil while waiting on more.
+// Messages that aren't chunks are returned as is. Malformed chunks, and the chunks of a letter overflowing the memory
+// cap, are rejected (dead-lettered when configured) and reported with an error.
+// The reassembled message acknowledges, nacks or rejects every one of its chunks.
+func (reassembler *Reassembler) Add(msg *ReceivedMessage) (*ReceivedMessage, error) {
+
+	chunkID, ok := msg.Delivery.Headers[ChunkIDHeader].(string)
+	if !ok {
+		return msg, nil
+	}
+
+	index, indexOk := chunkHeaderInt(msg.Delivery.Headers[ChunkIndexHeader])
+	count, countOk := chunkHeaderInt(msg.Delivery.Headers[ChunkCountHeader])
+	if !indexOk || !countOk || count <= 0 || index < 0 || index >= count {
+		rejectChunks([]*ReceivedMessage{msg})
+		return nil, fmt.Errorf("malformed chunk of LetterID %s (index: %v, count: %v)",
+			chunkID, msg.Delivery.Headers[ChunkIndexHeader], msg.Delivery.Headers[ChunkCountHeader])
+	}
+
+	reassembler.lock.Lock()
+	defer reassembler.lock.Unlock()
+
+	set, ok := reassembler.pending[chunkID]
+	if !ok {
+		set = &chunkSet{
+			chunks:  make([]*ReceivedMessage, count),
+			started: time.Now(),
+		}
+		reassembler.pending[chunkID] = set
+	}
+
+	if count != len(set.chunks) {
+		reassembler.discard(chunkID, set)
+		rejectChunks(append(set.chunks, msg))
+		return nil, fmt.Errorf("chunks of LetterID %s disagree on the chunk count", chunkID)
+	}
+
+	// Redelivered chunk, the previous delivery can no longer be acknowledged.
+	if previous := set.chunks[index]; previous != nil {
+		set.received--
+		set.bytes -= len(previous.Body)
+		reassembler.bytes -= len(previous.Body)
+	}
+
+	if reassembler.bytes+len(msg.Body) > reassembler.maxBytes {
+		reassembler.discard(chunkID, set)
+		rejectChunks(append(set.chunks, msg))
+		return nil, fmt.Errorf("%w: LetterID %s", ErrReassemblyOverflow, chunkID)
+	}
+
+	set.chunks[index] = msg
+	set.received++
+	set.bytes += len(msg.Body)
+	reassembler.bytes += len(msg.Body)
+
+	if set.received < len(set.chunks) {
+		return nil, nil
+	}
+
+	reassembler.discard(chunkID, set)
+
+	return reassembleChunks(set), nil
+}
+
+// Expire rejects (dead-letters when configured) the chunks of letters not completed within the timeout.
+// Returns an error per expired letter.
+func (reassembler *Reassembler) Expire(now time.Time) []error {
+	reassembler.lock.Lock()
+	defer reassembler.lock.Unlock()
+
+	var errs []error
+	for chunkID, set := range reassembler.pending {
+		if now.Sub(set.started) < reassembler.timeout {
+			continue
+		}
+
+		reassembler.discard(chunkID, set)
+		rejectChunks(set.chunks)
+		errs = append(errs, fmt.Errorf("timed out reassembling LetterID %s (%d of %d chunks received)", chunkID, set.received, len(set.chunks)))
+	}
+
+	return errs
+}
+
+// Reset drops every pending chunk without settling them, ex. when the channel they were received on closed.
+func (reassembler *Reassembler) Reset() {
+	reassembler.lock.Lock()
+	defer reassembler.lock.Unlock()
+
+	reassembler.pending = make(map[string]*chunkSet)
+	reassembler.bytes = 0
+}
+
+// rejectPending rejects (dead-letters when configured) every pending chunk, ex. when the subscription is canceled
+// while the channel they were received on stays open.
+func (reassembler *Reassembler) rejectPending() {
+	reassembler.lock.Lock()
+	defer reassembler.lock.Unlock()
+
+	for chunkID, set := range reassembler.pending {
+		reassembler.discard(chunkID, set)
+		rejectChunks(set.chunks)
+	}
+}
+
+// Pending returns the count of letters waiting on chunks and the bytes held.
+func (reassembler *Reassembler) Pending() (int, int) {
+	reassembler.lock.Lock()
+	defer reassembler.lock.Unlock()
+
+	return len(reassembler.pending), reassembler.bytes
+}
+
+func (reassembler *Reassembler) discard(chunkID string, set *chunkSet) {
+	delete(reassembler.pending, chunkID)
+	reassembler.bytes -= set.bytes
+}
+
+// reassembleChunks builds the message from the first chunk's properties and every chunk's body.
+func reassembleChunks(set *chunkSet) *ReceivedMessage {
+
+	body := make([]byte, 0, set.bytes)
+	for _, chunk := range set.chunks {
+		body = append(body, chunk.Body...)
+	}
+
+	delivery := set.chunks[0].Delivery
+	delivery.Body = body
+	delivery.Headers = make(amqp.Table, len(delivery.Headers))
+	for name, value := range set.chunks[0].Delivery.Headers {
+		switch name {
+		case ChunkIDHeader, ChunkIndexHeader, ChunkCountHeader:
+		default:
+			delivery.Headers[name] = value
+		}
+	}
+
+	msg := NewReceivedMessage(set.chunks[0].IsAckable, delivery)
+	for _, chunk := range set.chunks[1:] {
+		msg.chunks = append(msg.chunks, chunk.Delivery)
+	}
+
+	return msg
+}
+
+func rejectChunks(chunks []*ReceivedMessage) {
+	for _, chunk := range chunks {
+		if chunk != nil && chunk.IsAckable {
+			_ = chunk.Reject(false)
+		}
+	}
+}
+
+func chunkHeaderInt(value interface{}) (int, bool) {
+	switch number := value.(type) {
+	case int:
+		return number, true
+	case int32:
+		return int(number), true
+	case int64:
+		return int(number), true
+	default:
+		return 0, false
+	}
+}
+
+// UseReassembler reassembles chunked letters before they reach the action or ReceivedMessages.
+// Set it before starting to consume. Consumers of a RabbitService get their own from its ChunkingConfig.
+func (con *Consumer) UseReassembler(reassembler *Reassembler) {
+	con.conLock.Lock()
+	defer con.conLock.Unlock()
+
+	con.reassembler = reassembler
+}
+
+// reassemble returns the message to hand out, nil while its letter is still missing chunks.
+func (con *Consumer) reassemble(msg *ReceivedMessage) *ReceivedMessage {
+
+	if con.reassembler == nil {
+		return msg
+	}
+
+	msg, err := con.reassembler.Add(msg)
+	if err != nil {
+		con.sendError(err)
+	}
+
+	return msg
+}
+
+// resetChunks drops the pending chunks of a closed channel, they're redelivered on the next one.
+func (con *Consumer) resetChunks() {
+
+	if con.reassembler != nil {
+		con.reassembler.Reset()
+	}
+}
+
+// rejectChunks rejects the pending chunks of a canceled subscription, they'd otherwise stay unacknowledged.
+func (con *Consumer) rejectChunks() {
+
+	if con.reassembler != nil {
+		con.reassembler.rejectPending()
+	}
+}
+
+// expireChunks rejects the chunks of letters past the ReassemblyTimeout, checked on every pass of the consume loop.
+func (con *Consumer) expireChunks() {
+
+	if con.reassembler == nil {
+		return
+	}
+
+	for _, err := range con.reassembler.Expire(time.Now()) {
+		con.sendError(err)
+	}
+}
@@ -0,0 +1,242 @@
+package tcr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// ClaimCheckHeader holds the BlobStore key of a body that was checked in.
+	ClaimCheckHeader = "x-tcr-claim-check"
+	// ClaimCheckSizeHeader holds the size of the original body that was checked in.
+	ClaimCheckSizeHeader = "x-tcr-claim-check-size"
+
+	defaultClaimCheckThreshold = 1024 * 1024
+)
+
+// BlobStore stores the bodies of letters checked in with a ClaimCheck.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// FileBlobStore is a BlobStore keeping each blob as a file in a (ideally shared) directory.
+type FileBlobStore struct {
+	directory string
+}
+
+// NewFileBlobStore creates a FileBlobStore in the directory, creating it if needed.
+func NewFileBlobStore(directory string) (*FileBlobStore, error) {
+
+	if directory == "" {
+		return nil, errors.New("blob store directory can't be blank")
+	}
+
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, err
+	}
+
+	return &FileBlobStore{directory: directory}, nil
+}
+
+// Put writes the blob to a temporary file first so readers never see a partial blob.
+func (store *FileBlobStore) Put(ctx context.Context, key string, data []byte) error {
+
+	path, err := store.path(key)
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(store.directory, ".tmp-"+key)
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+// Get reads the blob.
+func (store *FileBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+
+	path, err := store.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadFile(path)
+}
+
+// Delete removes the blob, a blob that doesn't exist is not an error.
+func (store *FileBlobStore) Delete(ctx context.Context, key string) error {
+
+	path, err := store.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (store *FileBlobStore) path(key string) (string, error) {
+
+	if key == "" || key != filepath.Base(key) || key[0] == '.' {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+
+	return filepath.Join(store.directory, key), nil
+}
+
+// ClaimCheck moves bodies above the Threshold out of the broker and into a BlobStore, publishing a
+// reference header in their place. Consumers using the same ClaimCheck transparently get the body back.
+type ClaimCheck struct {
+	Store           BlobStore
+	Threshold       int  // bodies larger than this (in bytes) are checked in
+	DeleteAfterRead bool // delete the blob once the message is acknowledged (or received, when auto-acking)
+}
+
+// NewClaimCheckFromConfig creates a ClaimCheck with a FileBlobStore from the ClaimCheckConfig.
+func NewClaimCheckFromConfig(config *ClaimCheckConfig) (*ClaimCheck, error) {
+
+	store, err := NewFileBlobStore(config.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	claimCheck := &ClaimCheck{
+		Store:           store,
+		Threshold:       config.Threshold,
+		DeleteAfterRead: config.DeleteAfterRead,
+	}
+
+	if claimCheck.Threshold <= 0 {
+		claimCheck.Threshold = defaultClaimCheckThreshold
+	}
+
+	return claimCheck, nil
+}
+
+// CheckIn stores the body of a letter over the Threshold and returns a copy of the letter carrying the reference instead.
+// Letters under the Threshold, or already checked in, are returned as is.
+func (claimCheck *ClaimCheck) CheckIn(ctx context.Context, letter *Letter) (*Letter, error) {
+
+	if !claimCheck.checksIn(letter) {
+		return letter, nil
+	}
+
+	key := letter.LetterID.String()
+	if err := claimCheck.Store.Put(ctx, key, letter.Body); err != nil {
+		return nil, fmt.Errorf("failed to check in the body of LetterID %s: %w", key, err)
+	}
+
+	envelope := *letter.Envelope
+	envelope.Headers = make(map[string]interface{}, len(letter.Envelope.Headers)+2)
+	for name, value := range letter.Envelope.Headers {
+		envelope.Headers[name] = value
+	}
+	envelope.Headers[ClaimCheckHeader] = key
+	envelope.Headers[ClaimCheckSizeHeader] = int64(len(letter.Body))
+
+	return &Letter{
+		LetterID:   letter.LetterID,
+		RetryCount: letter.RetryCount,
+		Body:       []byte{},
+		Envelope:   &envelope,
+	}, nil
+}
+
+// checksIn returns true when CheckIn would store the body of the letter.
+func (claimCheck *ClaimCheck) checksIn(letter *Letter) bool {
+
+	if len(letter.Body) <= claimCheck.Threshold {
+		return false
+	}
+
+	_, ok := letter.Envelope.Headers[ClaimCheckHeader]
+	return !ok
+}
+
+// CheckOut replaces the body of a ReceivedMessage carrying a reference with the stored body.
+// Messages without a reference are left untouched.
+func (claimCheck *ClaimCheck) CheckOut(ctx context.Context, msg *ReceivedMessage) error {
+
+	key, ok := msg.Delivery.Headers[ClaimCheckHeader].(string)
+	if !ok {
+		return nil
+	}
+
+	body, err := claimCheck.Store.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to check out the body of MessageID %s: %w", msg.MessageID, err)
+	}
+
+	msg.Body = body
+	msg.Delivery.Body = body
+
+	if claimCheck.DeleteAfterRead {
+		if msg.IsAckable {
+			msg.claimCheck, msg.claimKey = claimCheck, key
+		} else {
+			_ = claimCheck.Store.Delete(ctx, key)
+		}
+	}
+
+	return nil
+}
+
+// UseClaimCheck checks in the bodies of letters over the ClaimCheck Threshold on every publish path.
+func (pub *Publisher) UseClaimCheck(claimCheck *ClaimCheck) {
+	pub.pubLock.Lock()
+	defer pub.pubLock.Unlock()
+
+	pub.claimCheck = claimCheck
+}
+
+// UseClaimCheck transparently checks out the bodies of received messages carrying a claim check reference.
+// Messages whose body can't be checked out are reported on Errors and rejected (dead-lettered when configured).
+// Consumers of a RabbitService get its ClaimCheckConfig, Consumers created on their own need this to check out.
+func (con *Consumer) UseClaimCheck(claimCheck *ClaimCheck) {
+	con.conLock.Lock()
+	defer con.conLock.Unlock()
+
+	con.claimCheck = claimCheck
+}
+
+// checkOut checks out the body of the message when a ClaimCheck is used, returns false when the message was rejected.
+func (con *Consumer) checkOut(msg *ReceivedMessage) bool {
+
+	if con.claimCheck == nil {
+		return true
+	}
+
+	if err := con.claimCheck.CheckOut(context.Background(), msg); err != nil {
+		con.sendError(err)
+		if msg.IsAckable {
+			_ = msg.Reject(false)
+		}
+		return false
+	}
+
+	return true
+}
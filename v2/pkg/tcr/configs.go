@@ -7,26 +7,63 @@ type RabbitSeasoning struct {
 	PoolConfig        *PoolConfig                `json:"PoolConfig" yaml:"PoolConfig"`
 	ConsumerConfigs   map[string]*ConsumerConfig `json:"ConsumerConfigs" yaml:"ConsumerConfigs"`
 	PublisherConfig   *PublisherConfig           `json:"PublisherConfig" yaml:"PublisherConfig"`
+	ClaimCheckConfig  *ClaimCheckConfig          `json:"ClaimCheckConfig,omitempty" yaml:"ClaimCheckConfig,omitempty"`
+	ChunkingConfig    *ChunkingConfig            `json:"ChunkingConfig,omitempty" yaml:"ChunkingConfig,omitempty"`
+}
+
+// ChunkingConfig represents settings for splitting large bodies into chunk messages and reassembling them.
+// Only applied to the Publisher and Consumers of a RabbitService, call UseChunking and UseReassembler on others.
+// Every chunked letter is published on its own transient confirm channel, not one from the ConnectionPool.
+type ChunkingConfig struct {
+	Enabled            bool   `json:"Enabled" yaml:"Enabled"`
+	ChunkSize          int    `json:"ChunkSize" yaml:"ChunkSize"`                   // bodies larger than this many bytes are split (default 512KB)
+	ReassemblyTimeout  uint32 `json:"ReassemblyTimeout" yaml:"ReassemblyTimeout"`   // milliseconds to wait for every chunk (default 60000)
+	MaxReassemblyBytes int    `json:"MaxReassemblyBytes" yaml:"MaxReassemblyBytes"` // cap on chunk bytes held per consumer (default 64MB)
+}
+
+// ClaimCheckConfig represents settings for moving large bodies out of the broker into a FileBlobStore.
+// Only applied to the Publisher and Consumers of a RabbitService, call UseClaimCheck on others.
+type ClaimCheckConfig struct {
+	Enabled         bool   `json:"Enabled" yaml:"Enabled"`
+	Directory       string `json:"Directory" yaml:"Directory"`             // shared by publishers and consumers
+	Threshold       int    `json:"Threshold" yaml:"Threshold"`             // bodies larger than this many bytes are checked in (default 1MB)
+	DeleteAfterRead bool   `json:"DeleteAfterRead" yaml:"DeleteAfterRead"` // delete blobs once the message is acknowledged
 }
 
 // PoolConfig represents settings for creating/configuring pools.
 type PoolConfig struct {
-	ApplicationName      string     `json:"ApplicationName" yaml:"ApplicationName"`
-	URI                  string     `json:"URI" yaml:"URI"`
-	Heartbeat            uint32     `json:"Heartbeat" yaml:"Heartbeat"`
-	ConnectionTimeout    uint32     `json:"ConnectionTimeout" yaml:"ConnectionTimeout"`
-	SleepOnErrorInterval uint32     `json:"SleepOnErrorInterval" yaml:"SleepOnErrorInterval"` // sleep length on errors
-	MaxConnectionCount   uint64     `json:"MaxConnectionCount" yaml:"MaxConnectionCount"`   // number of connections to create in the pool
-	MaxCacheChannelCount uint64     `json:"MaxCacheChannelCount" yaml:"MaxCacheChannelCount"` // number of channels to be cached in the pool
-	TLSConfig            *TLSConfig `json:"TLSConfig" yaml:"TLSConfig"`            // TLS settings for connection with AMQPS.
+	ApplicationName                string                 `json:"ApplicationName" yaml:"ApplicationName"`
+	URI                            string                 `json:"URI" yaml:"URI"`
+	Heartbeat                      uint32                 `json:"Heartbeat" yaml:"Heartbeat"`
+	ConnectionTimeout              uint32                 `json:"ConnectionTimeout" yaml:"ConnectionTimeout"`
+	SleepOnErrorInterval           uint32                 `json:"SleepOnErrorInterval" yaml:"SleepOnErrorInterval"`                     // sleep length on errors
+	MaxConnectionCount             uint64                 `json:"MaxConnectionCount" yaml:"MaxConnectionCount"`                         // number of connections to create in the pool
+	MaxCacheChannelCount           uint64                 `json:"MaxCacheChannelCount" yaml:"MaxCacheChannelCount"`                     // number of channels to be cached in the pool
+	MinCacheChannelCount           uint64                 `json:"MinCacheChannelCount" yaml:"MinCacheChannelCount"`                     // channels created up front, the rest are created on demand up to MaxCacheChannelCount (0 creates all up front)
+	MaxCacheNonConfirmChannelCount uint64                 `json:"MaxCacheNonConfirmChannelCount" yaml:"MaxCacheNonConfirmChannelCount"` // non-confirm channels cached, on demand, for fire-and-forget publishing and topology (0 uses confirm channels)
+	ChannelIdleTimeout             uint32                 `json:"ChannelIdleTimeout" yaml:"ChannelIdleTimeout"`                         // seconds a cached channel may sit idle before being closed, down to MinCacheChannelCount (0 disables)
+	MaxRecoveryInterval            uint32                 `json:"MaxRecoveryInterval" yaml:"MaxRecoveryInterval"`                       // seconds a connection may spend recovering before the pool is reported as not live (default 60)
+	TLSConfig                      *TLSConfig             `json:"TLSConfig" yaml:"TLSConfig"`                                           // TLS settings for connection with AMQPS.
+	CredentialsRefreshWindow       uint32                 `json:"CredentialsRefreshWindow" yaml:"CredentialsRefreshWindow"`             // seconds before credentials expire that connections are reconnected (default 60)
+	CredentialsProvider            CredentialsProvider    `json:"-" yaml:"-"`                                                           // consulted for the username and password on every dial and reconnect, overrides the URI credentials
+	ClientProperties               map[string]interface{} `json:"ClientProperties,omitempty" yaml:"ClientProperties,omitempty"`         // advertised to the server (ex. product, version, platform, custom tags), connection_name is always set
+	ChannelMax                     int                    `json:"ChannelMax" yaml:"ChannelMax"`                                         // max channels per connection, 0 lets the server decide
+	FrameSize                      int                    `json:"FrameSize" yaml:"FrameSize"`                                           // max frame size in bytes, 0 lets the server decide
+	Locale                         string                 `json:"Locale" yaml:"Locale"`                                                 // connection locale (ex. en_US)
+	Dial                           Dialer                 `json:"-" yaml:"-"`                                                           // custom dialer (ex. unix sockets, proxies, keep-alive), amqp.DefaultDial with ConnectionTimeout when nil
 }
 
 // TLSConfig represents settings for configuring TLS.
 type TLSConfig struct {
-	EnableTLS         bool   `json:"EnableTLS" yaml:"EnableTLS"` // Use TLSConfig to create connections with AMQPS uri.
-	PEMCertLocation   string `json:"PEMCertLocation" yaml:"PEMCertLocation"`
-	LocalCertLocation string `json:"LocalCertLocation" yaml:"LocalCertLocation"`
-	CertServerName    string `json:"CertServerName" yaml:"CertServerName"`
+	EnableTLS          bool   `json:"EnableTLS" yaml:"EnableTLS"`                   // Use TLSConfig to create connections with AMQPS uri.
+	PEMCertLocation    string `json:"PEMCertLocation" yaml:"PEMCertLocation"`       // CA bundle used to verify the server, system roots when blank.
+	LocalCertLocation  string `json:"LocalCertLocation" yaml:"LocalCertLocation"`   // client certificate.
+	LocalKeyLocation   string `json:"LocalKeyLocation" yaml:"LocalKeyLocation"`     // client private key, LocalCertLocation is used when blank.
+	CertServerName     string `json:"CertServerName" yaml:"CertServerName"`         // overrides the server name used to verify the server certificate.
+	MinVersion         string `json:"MinVersion" yaml:"MinVersion"`                 // minimum TLS version ("1.0", "1.1", "1.2", "1.3").
+	InsecureSkipVerify bool   `json:"InsecureSkipVerify" yaml:"InsecureSkipVerify"` // development only, skips server certificate verification.
+	UseExternalAuth    bool   `json:"UseExternalAuth" yaml:"UseExternalAuth"`       // authenticate with SASL EXTERNAL using the client certificate.
+	CertReloadInterval uint32 `json:"CertReloadInterval" yaml:"CertReloadInterval"` // seconds between checks for changed cert files, 0 disables. A change forces every connection to reconnect.
 }
 
 // ConsumerConfig represents settings for configuring a consumer with ease.
@@ -38,18 +75,95 @@ type ConsumerConfig struct {
 	Exclusive            bool                   `json:"Exclusive" yaml:"Exclusive"`
 	NoWait               bool                   `json:"NoWait" yaml:"NoWait"`
 	Args                 map[string]interface{} `json:"Args" yaml:"Args"`
-	QosCountOverride     int                    `json:"QosCountOverride" yaml:"QosCountOverride"`     // if zero ignored
-	SleepOnErrorInterval uint32                 `json:"SleepOnErrorInterval" yaml:"SleepOnErrorInterval"` // sleep on error
-	SleepOnIdleInterval  uint32                 `json:"SleepOnIdleInterval" yaml:"SleepOnIdleInterval"`  // sleep on idle
+	QosCountOverride     int                    `json:"QosCountOverride" yaml:"QosCountOverride"`                       // if zero ignored
+	SleepOnErrorInterval uint32                 `json:"SleepOnErrorInterval" yaml:"SleepOnErrorInterval"`               // sleep on error
+	SleepOnIdleInterval  uint32                 `json:"SleepOnIdleInterval" yaml:"SleepOnIdleInterval"`                 // sleep on idle
+	BatchConfig          *BatchConfig           `json:"BatchConfig,omitempty" yaml:"BatchConfig,omitempty"`             // used by StartConsumingBatches
+	Topology             *TopologyConfig        `json:"Topology,omitempty" yaml:"Topology,omitempty"`                   // declared before every (re)subscription
+	AdaptiveQosConfig    *AdaptiveQosConfig     `json:"AdaptiveQosConfig,omitempty" yaml:"AdaptiveQosConfig,omitempty"` // tunes the QosCountOverride when enabled
+	DedupConfig          *DedupConfig           `json:"DedupConfig,omitempty" yaml:"DedupConfig,omitempty"`             // skips redelivered duplicates when enabled
+}
+
+// AdaptiveQosConfig represents bounds for tuning the prefetch of a consumer to its handler latency and in-flight count.
+// Every change re-subscribes the consumer, RabbitMQ only applies a new prefetch to new subscriptions.
+type AdaptiveQosConfig struct {
+	Enabled        bool   `json:"Enabled" yaml:"Enabled"`
+	MinPrefetch    int    `json:"MinPrefetch" yaml:"MinPrefetch"`       // lower bound (default 1)
+	MaxPrefetch    int    `json:"MaxPrefetch" yaml:"MaxPrefetch"`       // upper bound (default 500)
+	TargetLatency  uint32 `json:"TargetLatency" yaml:"TargetLatency"`   // milliseconds from delivery to settlement to stay under (default 1000)
+	AdjustInterval uint32 `json:"AdjustInterval" yaml:"AdjustInterval"` // milliseconds between adjustments (default 5000)
+}
+
+// BatchConfig represents settings for consuming deliveries in batches.
+type BatchConfig struct {
+	Size           int    `json:"Size" yaml:"Size"`                     // deliveries per batch, keep the QosCountOverride at least this large (default 100)
+	Window         uint32 `json:"Window" yaml:"Window"`                 // milliseconds before handing out a partial batch (default 1000)
+	RequeueOnError bool   `json:"RequeueOnError" yaml:"RequeueOnError"` // requeue the batch when the handler fails, otherwise it's dead-lettered when configured
 }
 
 // PublisherConfig represents settings for configuring global settings for all Publishers with ease.
 type PublisherConfig struct {
-	AutoAck                bool   `json:"AutoAck" yaml:"AutoAck"`
-	SleepOnIdleInterval    uint32 `json:"SleepOnIdleInterval" yaml:"SleepOnIdleInterval"`
-	SleepOnErrorInterval   uint32 `json:"SleepOnErrorInterval" yaml:"SleepOnErrorInterval"`
-	PublishTimeOutInterval uint32 `json:"PublishTimeOutInterval" yaml:"PublishTimeOutInterval"`
-	MaxRetryCount          uint32 `json:"MaxRetryCount" yaml:"MaxRetryCount"`
+	AutoAck                bool             `json:"AutoAck" yaml:"AutoAck"`
+	SleepOnIdleInterval    uint32           `json:"SleepOnIdleInterval" yaml:"SleepOnIdleInterval"`
+	SleepOnErrorInterval   uint32           `json:"SleepOnErrorInterval" yaml:"SleepOnErrorInterval"`
+	PublishTimeOutInterval uint32           `json:"PublishTimeOutInterval" yaml:"PublishTimeOutInterval"`
+	MaxRetryCount          uint32           `json:"MaxRetryCount" yaml:"MaxRetryCount"`
+	SpoolConfig            *SpoolConfig     `json:"SpoolConfig,omitempty" yaml:"SpoolConfig,omitempty"`               // durable on-disk spool for queued letters
+	RateLimitConfig        *RateLimitConfig `json:"RateLimitConfig,omitempty" yaml:"RateLimitConfig,omitempty"`       // throttling applied to every publish
+	HighPriorityLane       *LaneConfig      `json:"HighPriorityLane,omitempty" yaml:"HighPriorityLane,omitempty"`     // default weight 6
+	NormalPriorityLane     *LaneConfig      `json:"NormalPriorityLane,omitempty" yaml:"NormalPriorityLane,omitempty"` // default weight 3
+	LowPriorityLane        *LaneConfig      `json:"LowPriorityLane,omitempty" yaml:"LowPriorityLane,omitempty"`       // default weight 1
+}
+
+// LaneConfig represents settings for one priority lane of the auto-publisher.
+type LaneConfig struct {
+	Weight   uint32 `json:"Weight" yaml:"Weight"`     // letters dequeued per round, relative to the other lanes
+	Capacity uint32 `json:"Capacity" yaml:"Capacity"` // letters buffered before queueing blocks (default 1000)
+}
+
+// RateLimitConfig represents settings for throttling publishing, zero values are unlimited.
+type RateLimitConfig struct {
+	MessagesPerSecond float64 `json:"MessagesPerSecond" yaml:"MessagesPerSecond"`
+	MessageBurst      float64 `json:"MessageBurst" yaml:"MessageBurst"` // default is one second worth of messages
+	BytesPerSecond    float64 `json:"BytesPerSecond" yaml:"BytesPerSecond"`
+	ByteBurst         float64 `json:"ByteBurst" yaml:"ByteBurst"`     // default is one second worth of bytes
+	MaxInFlight       int     `json:"MaxInFlight" yaml:"MaxInFlight"` // messages published but not yet confirmed
+	FailFast          bool    `json:"FailFast" yaml:"FailFast"`       // return ErrRateLimited instead of waiting, queued letters always wait
+}
+
+// SpoolConfig represents settings for the durable on-disk spool of letters queued for auto-publishing.
+type SpoolConfig struct {
+	Enabled        bool   `json:"Enabled" yaml:"Enabled"`
+	Directory      string `json:"Directory" yaml:"Directory"`           // directory holding the segment files
+	MaxSegmentSize uint64 `json:"MaxSegmentSize" yaml:"MaxSegmentSize"` // bytes written to a segment before rolling over to a new one (default 16MB)
+	SyncWrites     bool   `json:"SyncWrites" yaml:"SyncWrites"`         // fsync after every write, slower but survives power loss
+	MaxAttempts    int    `json:"MaxAttempts" yaml:"MaxAttempts"`       // failed publishes before a letter is dropped and reported in a failure receipt (default 10)
+	RetryBackoff   uint32 `json:"RetryBackoff" yaml:"RetryBackoff"`     // milliseconds before retrying a failed letter, doubling with every failure up to a minute (default 1000)
+}
+
+// OutboxConfig represents settings for an OutboxStore and the OutboxRelay publishing from it.
+type OutboxConfig struct {
+	TableName        string `json:"TableName" yaml:"TableName"`               // default tcr_outbox
+	PlaceholderStyle string `json:"PlaceholderStyle" yaml:"PlaceholderStyle"` // "?" (MySQL, SQLite) or "$" (PostgreSQL), default "?"
+	PollInterval     uint32 `json:"PollInterval" yaml:"PollInterval"`         // milliseconds between polls for unsent letters, default 1000
+	BatchSize        int    `json:"BatchSize" yaml:"BatchSize"`               // unsent letters relayed per poll, default 100
+	PublishTimeout   uint32 `json:"PublishTimeout" yaml:"PublishTimeout"`     // milliseconds to wait on a publish confirmation, default 5000
+}
+
+// DedupConfig represents settings for a DedupStore used by the Idempotent consumer middleware.
+// NewConsumer and the RabbitService apply the ConsumerConfig DedupConfig, call UseDedup on others.
+type DedupConfig struct {
+	Enabled   bool   `json:"Enabled" yaml:"Enabled"`
+	Header    string `json:"Header" yaml:"Header"`       // header holding the ID, the MessageID when blank
+	TTL       uint32 `json:"TTL" yaml:"TTL"`             // milliseconds an ID is remembered, default 86400000 (a day)
+	Capacity  int    `json:"Capacity" yaml:"Capacity"`   // IDs kept in memory, the least recently marked evicted first, default 100000
+	Directory string `json:"Directory" yaml:"Directory"` // also logs the IDs to a file in the directory, surviving restarts
+}
+
+// RPCConfig represents settings for an RPCClient.
+type RPCConfig struct {
+	PrivateReplyQueue bool   `json:"PrivateReplyQueue" yaml:"PrivateReplyQueue"` // exclusive server named reply queue instead of amq.rabbitmq.reply-to
+	Timeout           uint32 `json:"Timeout" yaml:"Timeout"`                     // milliseconds to wait on a reply (an earlier context deadline wins), default 30000
 }
 
 // TopologyConfig allows you to build simple toplogies from a JSON file.
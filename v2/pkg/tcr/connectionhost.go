@@ -1,27 +1,42 @@
 package tcr
 
 import (
-	"crypto/tls"
 	"errors"
+	"fmt"
+	"net"
 	"sync"
 	"time"
 
 	"github.com/streadway/amqp"
 )
 
+// Dialer opens the network connection to the broker (ex. unix sockets, SOCKS/HTTP CONNECT proxies, custom keep-alive).
+type Dialer func(network, addr string) (net.Conn, error)
+
 // ConnectionHost is an internal representation of amqp.Connection.
 type ConnectionHost struct {
-	Connection         *amqp.Connection
-	ConnectionID       uint64
-	CachedChannelCount uint64
-	uri                string
-	connectionName     string
-	heartbeatInterval  time.Duration
-	connectionTimeout  time.Duration
-	tlsConfig          *TLSConfig
-	Errors             chan *amqp.Error
-	Blockers           chan amqp.Blocking
-	connLock           *sync.Mutex
+	Connection            *amqp.Connection
+	ConnectionID          uint64
+	CachedChannelCount    uint64
+	uri                   string
+	connectionName        string
+	heartbeatInterval     time.Duration
+	connectionTimeout     time.Duration
+	tlsConfig             *TLSConfig
+	credentialsProvider   CredentialsProvider
+	dialer                Dialer
+	clientProperties      map[string]interface{}
+	channelMax            int
+	frameSize             int
+	locale                string
+	Errors                chan *amqp.Error
+	Blockers              chan amqp.Blocking
+	connLock              *sync.Mutex
+	stateLock             *sync.RWMutex
+	recoveringSince       time.Time
+	lastError             error
+	lastErrorTime         time.Time
+	credentialsExpiration time.Time
 }
 
 // NewConnectionHost creates a simple ConnectionHost wrapper for management by end-user developer.
@@ -43,6 +58,38 @@ func NewConnectionHost(
 		Errors:            make(chan *amqp.Error, 10),
 		Blockers:          make(chan amqp.Blocking, 10),
 		connLock:          &sync.Mutex{},
+		stateLock:         &sync.RWMutex{},
+	}
+
+	ok := connHost.Connect()
+	if !ok {
+		return nil, errors.New("unable to connect")
+	}
+
+	return connHost, nil
+}
+
+// NewConnectionHostFromConfig creates a ConnectionHost wrapper using every connection setting in the PoolConfig,
+// including the CredentialsProvider consulted on every dial and reconnect, the custom dialer, client properties and tuning.
+func NewConnectionHostFromConfig(config *PoolConfig, connectionName string, connectionID uint64) (*ConnectionHost, error) {
+
+	connHost := &ConnectionHost{
+		uri:                 config.URI,
+		connectionName:      connectionName,
+		ConnectionID:        connectionID,
+		heartbeatInterval:   time.Duration(config.Heartbeat) * time.Second,
+		connectionTimeout:   time.Duration(config.ConnectionTimeout) * time.Second,
+		tlsConfig:           config.TLSConfig,
+		credentialsProvider: config.CredentialsProvider,
+		dialer:              config.Dial,
+		clientProperties:    config.ClientProperties,
+		channelMax:          config.ChannelMax,
+		frameSize:           config.FrameSize,
+		locale:              config.Locale,
+		Errors:              make(chan *amqp.Error, 10),
+		Blockers:            make(chan amqp.Blocking, 10),
+		connLock:            &sync.Mutex{},
+		stateLock:           &sync.RWMutex{},
 	}
 
 	ok := connHost.Connect()
@@ -62,7 +109,7 @@ func (ch *ConnectionHost) Connect() bool {
 func (ch *ConnectionHost) ConnectWithErrorHandler(errorHandler func(error)) bool {
 
 	// Compare, Lock, Recompare Strategy
-	if ch.Connection != nil && !ch.Connection.IsClosed() /* <- atomic */ {
+	if ch.IsOpen() {
 		return true
 	}
 
@@ -70,54 +117,24 @@ func (ch *ConnectionHost) ConnectWithErrorHandler(errorHandler func(error)) bool
 	defer ch.connLock.Unlock()
 
 	// Recompare, check if an operation is still necessary after acquiring lock.
-	if ch.Connection != nil && !ch.Connection.IsClosed() /* <- atomic */ {
+	if ch.IsOpen() {
 		return true
 	}
 
 	// Proceed with reconnectivity
-	var amqpConn *amqp.Connection
-	var actualTLSConfig *tls.Config
-	var err error
-
-	if ch.tlsConfig != nil && ch.tlsConfig.EnableTLS {
-
-		actualTLSConfig, err = CreateTLSConfig(
-			ch.tlsConfig.PEMCertLocation,
-			ch.tlsConfig.LocalCertLocation)
-		if err != nil {
-			if errorHandler != nil {
-				errorHandler(err)
-			}
-			return false
-		}
-	}
-
-	if actualTLSConfig == nil {
-		amqpConn, err = amqp.DialConfig(ch.uri, amqp.Config{
-			Heartbeat: ch.heartbeatInterval,
-			Dial:      amqp.DefaultDial(ch.connectionTimeout),
-			Properties: amqp.Table{
-				"connection_name": ch.connectionName,
-			},
-		})
-	} else {
-		amqpConn, err = amqp.DialConfig("amqps://"+ch.tlsConfig.CertServerName, amqp.Config{
-			Heartbeat:       ch.heartbeatInterval,
-			Dial:            amqp.DefaultDial(ch.connectionTimeout),
-			TLSClientConfig: actualTLSConfig,
-			Properties: amqp.Table{
-				"connection_name": ch.connectionName,
-			},
-		})
-	}
+	amqpConn, err := ch.dial()
 	if err != nil {
+		ch.setLastError(err)
 		if errorHandler != nil {
 			errorHandler(err)
 		}
 		return false
 	}
 
+	ch.stateLock.Lock()
 	ch.Connection = amqpConn
+	ch.stateLock.Unlock()
+
 	ch.Errors = make(chan *amqp.Error, 10)
 	ch.Blockers = make(chan amqp.Blocking, 10)
 
@@ -127,6 +144,122 @@ func (ch *ConnectionHost) ConnectWithErrorHandler(errorHandler func(error)) bool
 	return true
 }
 
+// dial builds the amqp.Config, consulting the TLSConfig and CredentialsProvider, and opens a new amqp.Connection.
+func (ch *ConnectionHost) dial() (*amqp.Connection, error) {
+
+	amqpConfig := amqp.Config{
+		Heartbeat:  ch.heartbeatInterval,
+		Dial:       ch.dialer,
+		ChannelMax: ch.channelMax,
+		FrameSize:  ch.frameSize,
+		Locale:     ch.locale,
+		Properties: amqp.Table{},
+	}
+
+	if amqpConfig.Dial == nil {
+		amqpConfig.Dial = amqp.DefaultDial(ch.connectionTimeout)
+	}
+
+	for key, value := range ch.clientProperties {
+		amqpConfig.Properties[key] = toAMQPValue(value)
+	}
+	amqpConfig.Properties["connection_name"] = ch.connectionName
+
+	var err error
+	uri := ch.uri
+	externalAuth := false
+	if ch.tlsConfig != nil && ch.tlsConfig.EnableTLS {
+
+		amqpConfig.TLSClientConfig, err = CreateTLSConfigFromConfig(ch.tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		uri, err = ch.tlsURI()
+		if err != nil {
+			return nil, err
+		}
+
+		if ch.tlsConfig.UseExternalAuth {
+			externalAuth = true
+			amqpConfig.SASL = []amqp.Authentication{&ExternalAuth{}}
+		}
+	}
+
+	var credentials *Credentials
+	if ch.credentialsProvider != nil && !externalAuth {
+
+		credentials, err = ch.credentialsProvider()
+		if err != nil {
+			return nil, err
+		}
+		if credentials == nil {
+			return nil, errors.New("credentials provider returned no credentials")
+		}
+
+		amqpConfig.SASL = []amqp.Authentication{
+			&amqp.PlainAuth{
+				Username: credentials.Username,
+				Password: credentials.Password,
+			},
+		}
+	}
+
+	amqpConn, err := amqp.DialConfig(uri, amqpConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	ch.stateLock.Lock()
+	ch.credentialsExpiration = time.Time{}
+	if credentials != nil {
+		ch.credentialsExpiration = credentials.Expiration
+	}
+	ch.stateLock.Unlock()
+
+	return amqpConn, nil
+}
+
+// toAMQPValue converts the maps nested in decoded JSON or YAML into amqp.Tables, which are the only maps amqp can encode.
+func toAMQPValue(value interface{}) interface{} {
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		table := amqp.Table{}
+		for key, nested := range typed {
+			table[key] = toAMQPValue(nested)
+		}
+		return table
+	case map[interface{}]interface{}: // ex. decoded by yaml.v2
+		table := amqp.Table{}
+		for key, nested := range typed {
+			table[fmt.Sprint(key)] = toAMQPValue(nested)
+		}
+		return table
+	case amqp.Table:
+		return toAMQPValue(map[string]interface{}(typed))
+	case []interface{}:
+		values := make([]interface{}, len(typed))
+		for i, nested := range typed {
+			values[i] = toAMQPValue(nested)
+		}
+		return values
+	default:
+		return value
+	}
+}
+
+// tlsURI keeps the credentials, port and vhost of the URI while switching it to AMQPS.
+// Without a URI, the CertServerName is dialed directly.
+func (ch *ConnectionHost) tlsURI() (string, error) {
+
+	if ch.uri == "" {
+		return "amqps://" + ch.tlsConfig.CertServerName, nil
+	}
+
+	return CreateTLSURI(ch.uri)
+}
+
 // PauseOnFlowControl allows you to wait and sleep while receiving flow control messages.
 // Sleeps for one second, repeatedly until the blocking has stopped.
 func (ch *ConnectionHost) PauseOnFlowControl() {
@@ -152,3 +285,62 @@ func (ch *ConnectionHost) PauseOnFlowControl() {
 		}
 	}
 }
+
+// IsOpen reports whether the underlying amqp.Connection exists and has not been closed.
+func (ch *ConnectionHost) IsOpen() bool {
+	ch.stateLock.RLock()
+	defer ch.stateLock.RUnlock()
+
+	return ch.Connection != nil && !ch.Connection.IsClosed( /* atomic */ )
+}
+
+// Recovering reports whether the ConnectionHost is currently being reconnected and since when.
+func (ch *ConnectionHost) Recovering() (bool, time.Time) {
+	ch.stateLock.RLock()
+	defer ch.stateLock.RUnlock()
+
+	return !ch.recoveringSince.IsZero(), ch.recoveringSince
+}
+
+// LastError returns the last error encountered while connecting.
+func (ch *ConnectionHost) LastError() error {
+	ch.stateLock.RLock()
+	defer ch.stateLock.RUnlock()
+
+	return ch.lastError
+}
+
+// LastErrorTime returns when the last error was encountered while connecting.
+func (ch *ConnectionHost) LastErrorTime() time.Time {
+	ch.stateLock.RLock()
+	defer ch.stateLock.RUnlock()
+
+	return ch.lastErrorTime
+}
+
+// CredentialsExpiration returns when the credentials of the current connection expire, zero value when they don't.
+func (ch *ConnectionHost) CredentialsExpiration() time.Time {
+	ch.stateLock.RLock()
+	defer ch.stateLock.RUnlock()
+
+	return ch.credentialsExpiration
+}
+
+func (ch *ConnectionHost) setRecovering(recovering bool) {
+	ch.stateLock.Lock()
+	defer ch.stateLock.Unlock()
+
+	if !recovering {
+		ch.recoveringSince = time.Time{}
+	} else if ch.recoveringSince.IsZero() {
+		ch.recoveringSince = time.Now()
+	}
+}
+
+func (ch *ConnectionHost) setLastError(err error) {
+	ch.stateLock.Lock()
+	defer ch.stateLock.Unlock()
+
+	ch.lastError = err
+	ch.lastErrorTime = time.Now()
+}
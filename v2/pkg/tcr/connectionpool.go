@@ -4,6 +4,7 @@ import (
 	"errors"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Workiva/go-datastructures/queue"
@@ -17,13 +18,21 @@ type ConnectionPool struct {
 	heartbeatInterval    time.Duration
 	connectionTimeout    time.Duration
 	connections          *queue.Queue
-	channels             chan *ChannelHost
+	channels             *channelCache
+	nonConfirmChannels   *channelCache
+	channelID            uint64
 	connectionID         uint64
 	poolRWLock           *sync.RWMutex
 	flaggedConnections   map[uint64]bool
+	connectionHosts      []*ConnectionHost
 	sleepOnErrorInterval time.Duration
+	maxRecoveryInterval  time.Duration
 	errorHandler         func(error)
 	unhealthyHandler     func(error)
+	lastError            error
+	lastErrorTime        time.Time
+	watcherStop          chan struct{}
+	watcherStopOnce      *sync.Once
 }
 
 // NewConnectionPool creates hosting structure for the ConnectionPool.
@@ -57,18 +66,52 @@ func NewConnectionPoolWithHandlers(config *PoolConfig, errorHandler func(error),
 		heartbeatInterval:    time.Duration(config.Heartbeat) * time.Second,
 		connectionTimeout:    time.Duration(config.ConnectionTimeout) * time.Second,
 		connections:          queue.New(int64(config.MaxConnectionCount)), // possible overflow error
-		channels:             make(chan *ChannelHost, config.MaxCacheChannelCount),
 		poolRWLock:           &sync.RWMutex{},
 		flaggedConnections:   make(map[uint64]bool),
 		sleepOnErrorInterval: time.Duration(config.SleepOnErrorInterval) * time.Millisecond,
+		maxRecoveryInterval:  time.Duration(config.MaxRecoveryInterval) * time.Second,
 		errorHandler:         errorHandler,
 		unhealthyHandler:     unhealthyHandler,
+		watcherStop:          make(chan struct{}),
+		watcherStopOnce:      &sync.Once{},
+	}
+
+	// Zero (or too large of a) minimum keeps the cache fully created up front.
+	minChannelCount := config.MinCacheChannelCount
+	if minChannelCount == 0 || minChannelCount > config.MaxCacheChannelCount {
+		minChannelCount = config.MaxCacheChannelCount
+	}
+
+	cp.channels = newChannelCache(true, minChannelCount, config.MaxCacheChannelCount)
+	cp.nonConfirmChannels = newChannelCache(false, 0, config.MaxCacheNonConfirmChannelCount)
+
+	// Certificates changing while the connections are dialed must still be reloaded.
+	var certModTime time.Time
+	if config.TLSConfig != nil {
+		certModTime = tlsFilesModTime(config.TLSConfig)
 	}
 
 	if ok := cp.initializeConnections(); !ok {
 		return nil, errors.New("initialization failed during connection creation")
 	}
 
+	if config.TLSConfig != nil && config.TLSConfig.EnableTLS && config.TLSConfig.CertReloadInterval > 0 {
+		go cp.watchCertificates(time.Duration(config.TLSConfig.CertReloadInterval)*time.Second, certModTime)
+	}
+
+	if config.CredentialsProvider != nil {
+		refreshWindow := defaultCredentialsRefreshWindow
+		if config.CredentialsRefreshWindow > 0 {
+			refreshWindow = time.Duration(config.CredentialsRefreshWindow) * time.Second
+		}
+
+		go cp.watchCredentials(refreshWindow)
+	}
+
+	if config.ChannelIdleTimeout > 0 && (minChannelCount < config.MaxCacheChannelCount || config.MaxCacheNonConfirmChannelCount > 0) {
+		go cp.evictIdleChannels(time.Duration(config.ChannelIdleTimeout) * time.Second)
+	}
+
 	return cp, nil
 }
 
@@ -76,16 +119,14 @@ func (cp *ConnectionPool) initializeConnections() bool {
 
 	cp.connectionID = 0
 	cp.connections = queue.New(int64(cp.Config.MaxConnectionCount))
+	cp.connectionHosts = make([]*ConnectionHost, 0, cp.Config.MaxConnectionCount)
 
 	for i := uint64(0); i < cp.Config.MaxConnectionCount; i++ {
 
-		connectionHost, err := NewConnectionHost(
-			cp.uri,
+		connectionHost, err := NewConnectionHostFromConfig(
+			&cp.Config,
 			cp.Config.ApplicationName+"-"+strconv.FormatUint(cp.connectionID, 10),
-			cp.connectionID,
-			cp.heartbeatInterval,
-			cp.connectionTimeout,
-			cp.Config.TLSConfig)
+			cp.connectionID)
 
 		if err != nil {
 			cp.handleError(err)
@@ -97,16 +138,188 @@ func (cp *ConnectionPool) initializeConnections() bool {
 			return false
 		}
 
+		cp.poolRWLock.Lock()
+		cp.connectionHosts = append(cp.connectionHosts, connectionHost)
+		cp.poolRWLock.Unlock()
+
 		cp.connectionID++
 	}
 
-	for i := uint64(0); i < cp.Config.MaxCacheChannelCount; i++ {
-		cp.channels <- cp.createCacheChannel(i)
+	cp.channelID = 0
+	for i := uint64(0); i < cp.channels.min; i++ {
+		id, _ := cp.reserveCacheChannel(cp.channels)
+		cp.channels.idle <- cp.createCacheChannel(id, true)
 	}
 
 	return true
 }
 
+// channelCache holds the idle ChannelHosts of one kind (confirm mode or not) and counts every channel created for it.
+type channelCache struct {
+	idle    chan *ChannelHost
+	ackable bool
+	count   uint64
+	min     uint64
+	max     uint64
+}
+
+func newChannelCache(ackable bool, min, max uint64) *channelCache {
+	return &channelCache{
+		idle:    make(chan *ChannelHost, max),
+		ackable: ackable,
+		min:     min,
+		max:     max,
+	}
+}
+
+// reserveCacheChannel counts a new channel towards the max of the cache, returning false when the cache is full.
+func (cp *ConnectionPool) reserveCacheChannel(cache *channelCache) (uint64, bool) {
+	cp.poolRWLock.Lock()
+	defer cp.poolRWLock.Unlock()
+
+	if cache.count >= cache.max {
+		return 0, false
+	}
+
+	id := cp.channelID
+	cache.count++
+	cp.channelID++
+
+	return id, true
+}
+
+// releaseCacheChannel stops counting a channel of the cache, returning false when the cache is already at its min.
+func (cp *ConnectionPool) releaseCacheChannel(cache *channelCache) bool {
+	cp.poolRWLock.Lock()
+	defer cp.poolRWLock.Unlock()
+
+	if cache.count <= cache.min {
+		return false
+	}
+
+	cache.count--
+	return true
+}
+
+// evictIdleChannels closes cached channels, down to the min of each cache, that haven't been used within the idleTimeout.
+func (cp *ConnectionPool) evictIdleChannels(idleTimeout time.Duration) {
+
+	for {
+		select {
+		case <-cp.watcherStop:
+			return
+		case <-time.After(idleTimeout / 2):
+		}
+
+		cp.evictIdleCacheChannels(cp.channels, idleTimeout)
+		cp.evictIdleCacheChannels(cp.nonConfirmChannels, idleTimeout)
+	}
+}
+
+func (cp *ConnectionPool) evictIdleCacheChannels(cache *channelCache, idleTimeout time.Duration) {
+
+	// Cycle through every idle channel once, least recently returned first.
+	idleCount := len(cache.idle)
+
+	for i := 0; i < idleCount; i++ {
+		select {
+		case chanHost := <-cache.idle:
+			if time.Since(chanHost.lastUsed) > idleTimeout && cp.releaseCacheChannel(cache) {
+				cp.closeCacheChannel(chanHost)
+				continue
+			}
+
+			cache.idle <- chanHost
+		default:
+			return
+		}
+	}
+}
+
+func (cp *ConnectionPool) closeCacheChannel(chanHost *ChannelHost) {
+
+	atomic.AddUint64(&chanHost.connHost.CachedChannelCount, ^uint64(0))
+
+	go func(*ChannelHost) {
+		defer func() { _ = recover() }()
+
+		chanHost.Close()
+	}(chanHost)
+}
+
+// watchCertificates recycles every connection, one at a time, when the TLS files change on disk. A reload forces a
+// reconnect: the channels of the consumers and publishers on each connection close and they recover as from any outage.
+func (cp *ConnectionPool) watchCertificates(interval time.Duration, lastModTime time.Time) {
+
+	for {
+		select {
+		case <-cp.watcherStop:
+			return
+		case <-time.After(interval):
+		}
+
+		modTime := tlsFilesModTime(cp.Config.TLSConfig)
+		if !modTime.After(lastModTime) {
+			continue
+		}
+
+		lastModTime = modTime
+
+		cp.poolRWLock.RLock()
+		connectionHosts := cp.connectionHosts
+		cp.poolRWLock.RUnlock()
+
+		for _, connHost := range connectionHosts {
+			cp.recycleConnection(connHost)
+		}
+	}
+}
+
+// watchCredentials recycles connections whose credentials are about to expire so they reconnect with fresh credentials.
+func (cp *ConnectionPool) watchCredentials(refreshWindow time.Duration) {
+
+	// Remembers which expiration a connection was already recycled for, in case the provider hasn't refreshed yet.
+	recycledFor := make(map[uint64]time.Time)
+
+	for {
+		select {
+		case <-cp.watcherStop:
+			return
+		case <-time.After(time.Second):
+		}
+
+		cp.poolRWLock.RLock()
+		connectionHosts := cp.connectionHosts
+		cp.poolRWLock.RUnlock()
+
+		for _, connHost := range connectionHosts {
+			expiration := connHost.CredentialsExpiration()
+			if expiration.IsZero() || time.Until(expiration) > refreshWindow || recycledFor[connHost.ConnectionID].Equal(expiration) {
+				continue
+			}
+
+			recycledFor[connHost.ConnectionID] = expiration
+			cp.recycleConnection(connHost)
+		}
+	}
+}
+
+// recycleConnection closes a healthy connection and reconnects it straight away.
+func (cp *ConnectionPool) recycleConnection(connHost *ConnectionHost) {
+
+	if !connHost.IsOpen() {
+		return
+	}
+
+	func() {
+		defer func() { _ = recover() }()
+
+		connHost.Connection.Close()
+	}()
+
+	cp.triggerConnectionRecovery(connHost)
+}
+
 // GetConnection gets a connection based on whats in the ConnectionPool (blocking under bad network conditions).
 // Flowcontrol (blocking) or transient network outages will pause here until cleared.
 // Uses the SleepOnErrorInterval to pause between retries.
@@ -146,6 +359,9 @@ func (cp *ConnectionPool) verifyHealthyConnection(connHost *ConnectionHost) {
 	select {
 	case err := <-connHost.Errors:
 		healthy = false
+		if err != nil {
+			cp.setLastError(err)
+		}
 		if cp.unhealthyHandler != nil {
 			cp.unhealthyHandler(err)
 		}
@@ -165,6 +381,9 @@ func (cp *ConnectionPool) verifyHealthyConnection(connHost *ConnectionHost) {
 
 func (cp *ConnectionPool) triggerConnectionRecovery(connHost *ConnectionHost) {
 
+	connHost.setRecovering(true)
+	defer connHost.setRecovering(false)
+
 	// InfiniteLoop: Stay here till we reconnect.
 	for {
 		ok := connHost.ConnectWithErrorHandler(cp.unhealthyHandler)
@@ -201,11 +420,38 @@ func (cp *ConnectionPool) ReturnConnection(connHost *ConnectionHost, flag bool)
 
 // GetChannelFromPool gets a cached ackable channel from the Pool if they exist or creates a channel.
 // A non-acked channel is always a transient channel.
-// Blocking if Ackable is true and the cache is empty.
+// New cache channels are created on demand up to MaxCacheChannelCount, after which this blocks until one is returned.
 // If you want a transient Ackable channel (un-managed), use CreateChannel directly.
 func (cp *ConnectionPool) GetChannelFromPool() *ChannelHost {
 
-	return <-cp.channels
+	return cp.getCacheChannel(cp.channels)
+}
+
+// GetNonConfirmChannelFromPool gets a cached channel, without publish confirmations, for fire-and-forget publishing.
+// Channels are created on demand up to MaxCacheNonConfirmChannelCount, after which this blocks until one is returned.
+// Falls back to GetChannelFromPool when MaxCacheNonConfirmChannelCount is 0.
+func (cp *ConnectionPool) GetNonConfirmChannelFromPool() *ChannelHost {
+
+	if cp.nonConfirmChannels.max == 0 {
+		return cp.getCacheChannel(cp.channels)
+	}
+
+	return cp.getCacheChannel(cp.nonConfirmChannels)
+}
+
+func (cp *ConnectionPool) getCacheChannel(cache *channelCache) *ChannelHost {
+
+	select {
+	case chanHost := <-cache.idle:
+		return chanHost
+	default:
+	}
+
+	if id, ok := cp.reserveCacheChannel(cache); ok {
+		return cp.createCacheChannel(id, cache.ackable)
+	}
+
+	return <-cache.idle
 }
 
 // ReturnChannel returns a Channel.
@@ -221,7 +467,12 @@ func (cp *ConnectionPool) ReturnChannel(chanHost *ChannelHost, erred bool) {
 			chanHost.FlushConfirms()
 		}
 
-		cp.channels <- chanHost
+		chanHost.lastUsed = time.Now()
+		if chanHost.Ackable {
+			cp.channels.idle <- chanHost
+		} else {
+			cp.nonConfirmChannels.idle <- chanHost
+		}
 		return
 	}
 
@@ -248,28 +499,51 @@ func (cp *ConnectionPool) reconnectChannel(chanHost *ChannelHost) {
 }
 
 // createCacheChannel allows you create a cached ChannelHost which helps wrap Amqp Channel functionality.
-func (cp *ConnectionPool) createCacheChannel(id uint64) *ChannelHost {
+// The channel is created on the connection with the least cached channels.
+func (cp *ConnectionPool) createCacheChannel(id uint64, ackable bool) *ChannelHost {
 
 	// InfiniteLoop: Stay till we have a good channel.
 	for {
-		connHost, err := cp.GetConnection()
+		connHost, err := cp.getLeastLoadedConnection()
 		if err != nil {
 			cp.handleError(err)
 			continue
 		}
 
-		chanHost, err := NewChannelHost(connHost, id, connHost.ConnectionID, true, true)
+		cp.verifyHealthyConnection(connHost)
+
+		chanHost, err := NewChannelHost(connHost, id, connHost.ConnectionID, ackable, true)
 		if err != nil {
 			cp.handleError(err)
-			cp.ReturnConnection(connHost, true)
+			cp.flagConnection(connHost.ConnectionID)
 			continue
 		}
 
-		cp.ReturnConnection(connHost, false)
+		atomic.AddUint64(&connHost.CachedChannelCount, 1)
+		chanHost.lastUsed = time.Now()
 		return chanHost
 	}
 }
 
+// getLeastLoadedConnection finds the connection hosting the fewest cached channels.
+func (cp *ConnectionPool) getLeastLoadedConnection() (*ConnectionHost, error) {
+	cp.poolRWLock.RLock()
+	defer cp.poolRWLock.RUnlock()
+
+	var leastLoaded *ConnectionHost
+	for _, connHost := range cp.connectionHosts {
+		if leastLoaded == nil || atomic.LoadUint64(&connHost.CachedChannelCount) < atomic.LoadUint64(&leastLoaded.CachedChannelCount) {
+			leastLoaded = connHost
+		}
+	}
+
+	if leastLoaded == nil {
+		return nil, errors.New("no connections available in ConnectionPool")
+	}
+
+	return leastLoaded, nil
+}
+
 // GetTransientChannel allows you create an unmanaged amqp Channel with the help of the ConnectionPool.
 func (cp *ConnectionPool) GetTransientChannel(ackable bool) *amqp.Channel {
 
@@ -333,22 +607,32 @@ func (cp *ConnectionPool) Shutdown() {
 		return
 	}
 
-	wg := &sync.WaitGroup{}
-ChannelFlushLoop:
-	for {
-		select {
-		case chanHost := <-cp.channels:
-			wg.Add(1)
-			// Started receiving panics on Channel.Close()
-			go func(*ChannelHost) {
-				defer wg.Done()
-				defer func() { _ = recover() }()
-
-				chanHost.Close()
-			}(chanHost)
+	cp.watcherStopOnce.Do(func() { close(cp.watcherStop) })
 
-		default:
-			break ChannelFlushLoop
+	// Only the idle channels stop being counted, the checked out ones still count until returned to the cache,
+	// which must never hold more than its max.
+	wg := &sync.WaitGroup{}
+	for _, cache := range []*channelCache{cp.channels, cp.nonConfirmChannels} {
+	ChannelFlushLoop:
+		for {
+			select {
+			case chanHost := <-cache.idle:
+				cp.poolRWLock.Lock()
+				cache.count--
+				cp.poolRWLock.Unlock()
+
+				wg.Add(1)
+				// Started receiving panics on Channel.Close()
+				go func(*ChannelHost) {
+					defer wg.Done()
+					defer func() { _ = recover() }()
+
+					chanHost.Close()
+				}(chanHost)
+
+			default:
+				break ChannelFlushLoop
+			}
 		}
 	}
 	wg.Wait()
@@ -377,11 +661,17 @@ ChannelFlushLoop:
 	wg.Wait()
 
 	cp.connections = queue.New(int64(cp.Config.MaxConnectionCount))
+
+	cp.poolRWLock.Lock()
 	cp.flaggedConnections = make(map[uint64]bool)
+	cp.connectionHosts = nil
+	cp.poolRWLock.Unlock()
+
 	cp.connectionID = 0
 }
 
 func (cp *ConnectionPool) handleError(err error) {
+	cp.setLastError(err)
 	if cp.errorHandler != nil {
 		cp.errorHandler(err)
 	}
@@ -389,3 +679,11 @@ func (cp *ConnectionPool) handleError(err error) {
 		time.Sleep(cp.sleepOnErrorInterval)
 	}
 }
+
+func (cp *ConnectionPool) setLastError(err error) {
+	cp.poolRWLock.Lock()
+	defer cp.poolRWLock.Unlock()
+
+	cp.lastError = err
+	cp.lastErrorTime = time.Now()
+}
@@ -1,14 +1,19 @@
 package tcr
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/streadway/amqp"
 )
 
+const defaultGetPollInterval = time.Duration(100) * time.Millisecond
+
 // Consumer receives messages from a RabbitMQ location.
 type Consumer struct {
 	Config               *ConsumerConfig
@@ -17,6 +22,7 @@ type Consumer struct {
 	QueueName            string
 	ConsumerName         string
 	errors               chan error
+	droppedErrors        uint64
 	sleepOnErrorInterval time.Duration
 	sleepOnIdleInterval  time.Duration
 	messageGroup         *sync.WaitGroup
@@ -29,13 +35,26 @@ type Consumer struct {
 	noWait               bool
 	args                 amqp.Table
 	qosCountOverride     int
+	claimCheck           *ClaimCheck
+	reassembler          *Reassembler
+	batcher              *consumeBatcher
+	topology             *TopologyConfig
+	recoveries           chan *ConsumerRecovery
+	adaptive             *adaptivePrefetch
+	middlewares          []Middleware
+	resubscribing        bool
+	consumerTag          string
+	pauseSignal          chan struct{}
+	manualPause          bool
+	healthPause          bool
 	conLock              *sync.Mutex
 }
 
 // NewConsumerFromConfig creates a new Consumer to receive messages from a specific queuename.
+// Call UseDedup to apply the DedupConfig, opening its store can fail.
 func NewConsumerFromConfig(config *ConsumerConfig, cp *ConnectionPool) *Consumer {
 
-	return &Consumer{
+	con := &Consumer{
 		Config:               config,
 		ConnectionPool:       cp,
 		Enabled:              config.Enabled,
@@ -52,8 +71,15 @@ func NewConsumerFromConfig(config *ConsumerConfig, cp *ConnectionPool) *Consumer
 		noWait:               config.NoWait,
 		args:                 amqp.Table(config.Args),
 		qosCountOverride:     config.QosCountOverride,
+		topology:             config.Topology,
+		recoveries:           make(chan *ConsumerRecovery, 100),
+		pauseSignal:          make(chan struct{}, 1),
 		conLock:              &sync.Mutex{},
 	}
+
+	con.UseAdaptiveQos(config.AdaptiveQosConfig)
+
+	return con
 }
 
 // NewConsumer creates a new Consumer to receive messages from a specific queuename.
@@ -76,7 +102,7 @@ func NewConsumer(
 		return nil, fmt.Errorf("consumer %q was not found in config", consumerName)
 	}
 
-	return &Consumer{
+	con := &Consumer{
 		Config:               config,
 		ConnectionPool:       cp,
 		Enabled:              true,
@@ -95,11 +121,22 @@ func NewConsumer(
 		noWait:               noWait,
 		args:                 args,
 		qosCountOverride:     qosCountOverride,
+		topology:             config.Topology,
+		recoveries:           make(chan *ConsumerRecovery, 100),
+		pauseSignal:          make(chan struct{}, 1),
 		conLock:              &sync.Mutex{},
-	}, nil
+	}
+
+	con.UseAdaptiveQos(config.AdaptiveQosConfig)
+
+	if err := con.UseDedup(config.DedupConfig); err != nil {
+		return nil, err
+	}
+
+	return con, nil
 }
 
-// Get gets a single message from any queue. Auto-Acknowledges.
+// Get gets a single message from any queue. Auto-Acknowledges, use GetAckable when the message must survive a crash.
 func (con *Consumer) Get(queueName string) (*amqp.Delivery, error) {
 
 	// Get Channel
@@ -119,7 +156,7 @@ func (con *Consumer) Get(queueName string) (*amqp.Delivery, error) {
 	return nil, nil
 }
 
-// GetBatch gets a group of messages from any queue. Auto-Acknowledges.
+// GetBatch gets a group of messages from any queue. Auto-Acknowledges, use GetBatchAckable when the messages must survive a crash.
 func (con *Consumer) GetBatch(queueName string, batchSize int) ([]*amqp.Delivery, error) {
 
 	if batchSize < 1 {
@@ -155,23 +192,88 @@ GetBatchLoop:
 	return messages, nil
 }
 
-// StartConsuming starts the Consumer.
-func (con *Consumer) StartConsuming() {
-	con.conLock.Lock()
-	defer con.conLock.Unlock()
+// GetAckable gets a single message from any queue without acknowledging it, polling until one arrives or the context is done.
+// The message is bound to a held channel: settle it, then call release to close the channel, which requeues it if it wasn't
+// acknowledged. Release is never nil and safe to call more than once.
+func (con *Consumer) GetAckable(ctx context.Context, queueName string) (*ReceivedMessage, func(), error) {
 
-	if con.Enabled {
+	messages, release, err := con.GetBatchAckable(ctx, queueName, 1)
+	if err != nil {
+		return nil, release, err
+	}
 
-		con.FlushErrors()
-		con.FlushStop()
+	return messages[0], release, nil
+}
 
-		go con.startConsumeLoop(nil)
-		con.started = true
+// GetBatchAckable gets up to batchSize messages from any queue without acknowledging them, returning as soon as the queue
+// is empty and at least one message was received, otherwise polling until one arrives or the context is done.
+// The messages are bound to a held channel: settle them, then call release to close the channel, which requeues those
+// that weren't acknowledged. Release is never nil and safe to call more than once.
+func (con *Consumer) GetBatchAckable(ctx context.Context, queueName string, batchSize int) ([]*ReceivedMessage, func(), error) {
+
+	noRelease := func() {}
+	if batchSize < 1 {
+		return nil, noRelease, errors.New("can't get a batch of messages whose size is less than 1")
+	}
+
+	pollInterval := con.sleepOnIdleInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultGetPollInterval
 	}
+
+	channel := con.ConnectionPool.GetTransientChannel(false)
+	once := &sync.Once{}
+	release := func() {
+		once.Do(func() {
+			defer func() {
+				_ = recover()
+			}()
+			channel.Close()
+		})
+	}
+
+	messages := make([]*ReceivedMessage, 0, batchSize)
+	for len(messages) < batchSize {
+		amqpDelivery, ok, err := channel.Get(queueName, false)
+		if err != nil {
+			release()
+			return nil, noRelease, err
+		}
+
+		if ok {
+			msg := NewReceivedMessage(true, amqpDelivery)
+			if con.checkOut(msg) {
+				messages = append(messages, msg)
+			}
+			continue
+		}
+
+		if len(messages) > 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			release()
+			return nil, noRelease, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+
+	return messages, release, nil
+}
+
+// StartConsuming starts the Consumer.
+func (con *Consumer) StartConsuming() {
+	con.startConsuming(nil, nil)
 }
 
 // StartConsumingWithAction starts the Consumer invoking a method on every ReceivedMessage.
 func (con *Consumer) StartConsumingWithAction(action func(*ReceivedMessage)) {
+	con.startConsuming(action, nil)
+}
+
+func (con *Consumer) startConsuming(action func(*ReceivedMessage), batcher *consumeBatcher) {
 	con.conLock.Lock()
 	defer con.conLock.Unlock()
 
@@ -180,13 +282,27 @@ func (con *Consumer) StartConsumingWithAction(action func(*ReceivedMessage)) {
 		con.FlushErrors()
 		con.FlushStop()
 
-		go con.startConsumeLoop(action)
+		con.batcher = batcher
+		go con.startConsumeLoop(con.wrapAction(action))
 		con.started = true
 	}
 }
 
 func (con *Consumer) startConsumeLoop(action func(*ReceivedMessage)) {
 
+	var lostAt time.Time // when the last subscription was lost, zero until then
+	attempts := 0
+
+	// A known tag is needed to cancel the subscription when pausing.
+	con.consumerTag = con.ConsumerName
+	if con.consumerTag == "" {
+		con.consumerTag = "tcr-" + uuid.New().String()
+	}
+
+	// The channel stays reserved to the consumer across Pause, Resume and resubscribes, the app may still settle
+	// deliveries received on it. It's only returned to the pool once closed or the consumer stops.
+	var chanHost *ChannelHost
+
 ConsumeLoop:
 	for {
 		// Detect if we should stop consuming.
@@ -199,28 +315,67 @@ ConsumeLoop:
 			break
 		}
 
+		if con.waitWhilePaused() {
+			break ConsumeLoop
+		}
+
 		// Get ChannelHost
-		chanHost := con.ConnectionPool.GetChannelFromPool()
+		if chanHost == nil {
+			chanHost = con.ConnectionPool.GetChannelFromPool()
+		}
 
 		// Configure RabbitMQ channel QoS for Consumer
-		if con.qosCountOverride > 0 {
-			_ = chanHost.Channel.Qos(con.qosCountOverride, 0, false)
+		if prefetch := con.Prefetch(); prefetch > 0 {
+			_ = chanHost.Channel.Qos(prefetch, 0, false)
 		}
 
+		chanHost.FlushCancellations()
+
+		// Declare the topology the consumer depends on, it may have vanished with the previous connection.
+		redeclared, err := con.declareTopology(chanHost.Channel)
+
 		// Initiate consuming process.
-		deliveryChan, err := chanHost.Channel.Consume(con.QueueName, con.ConsumerName, con.autoAck, con.exclusive, false, con.noWait, nil)
+		var deliveryChan <-chan amqp.Delivery
+		if err == nil {
+			deliveryChan, err = chanHost.Channel.Consume(con.QueueName, con.consumerTag, con.autoAck, con.exclusive, false, con.noWait, nil)
+		}
 		if err != nil {
 			con.ConnectionPool.ReturnChannel(chanHost, true)
-			if con.sleepOnErrorInterval > 0 {
-				time.Sleep(con.sleepOnErrorInterval)
-			}
+			chanHost = nil
+			attempts++
+			time.Sleep(con.resubscribeBackoff(attempts))
 			continue
 		}
 
+		if !lostAt.IsZero() {
+			con.notifyRecovery(&ConsumerRecovery{
+				ConsumerName: con.ConsumerName,
+				QueueName:    con.QueueName,
+				Attempts:     attempts + 1,
+				Downtime:     time.Since(lostAt),
+				Redeclared:   redeclared,
+			})
+		}
+
 		// Process delivered messages by the consumer, returns true when we are to stop all consuming.
-		if con.processDeliveries(deliveryChan, chanHost, action) {
+		stop, held := con.processDeliveries(deliveryChan, chanHost, action)
+		if !held {
+			chanHost = nil
+		}
+		if stop {
 			break ConsumeLoop
 		}
+
+		lostAt = time.Now()
+		attempts = 0
+		if con.Paused() || con.resubscribing {
+			lostAt = time.Time{} // resuming or changing the prefetch isn't a recovery
+			con.resubscribing = false
+		}
+	}
+
+	if chanHost != nil {
+		con.ConnectionPool.ReturnChannel(chanHost, false)
 	}
 
 	con.conLock.Lock()
@@ -237,8 +392,9 @@ ConsumeLoop:
 	con.conLock.Unlock()
 }
 
-// ProcessDeliveries is the inner loop for processing the deliveries and returns true to break outer loop.
-func (con *Consumer) processDeliveries(deliveryChan <-chan amqp.Delivery, chanHost *ChannelHost, action func(*ReceivedMessage)) bool {
+// ProcessDeliveries is the inner loop for processing the deliveries, returns true to break outer loop and whether
+// the channel is still held by the consumer (otherwise it was returned to the pool).
+func (con *Consumer) processDeliveries(deliveryChan <-chan amqp.Delivery, chanHost *ChannelHost, action func(*ReceivedMessage)) (bool, bool) {
 
 	for {
 		// Listen for channel closure (close errors).
@@ -247,11 +403,14 @@ func (con *Consumer) processDeliveries(deliveryChan <-chan amqp.Delivery, chanHo
 		case errorMessage := <-chanHost.Errors:
 			if errorMessage != nil {
 				con.ConnectionPool.ReturnChannel(chanHost, true)
-				con.errors <- fmt.Errorf("consumer's current channel closed\r\n[reason: %s]\r\n[code: %d]", errorMessage.Reason, errorMessage.Code)
+				con.resetChunks()
+				con.resetBatch()
+				con.forgetInFlight()
+				con.sendError(fmt.Errorf("consumer's current channel closed\r\n[reason: %s]\r\n[code: %d]", errorMessage.Reason, errorMessage.Code))
 				if con.sleepOnErrorInterval > 0 {
 					time.Sleep(con.sleepOnErrorInterval)
 				}
-				return false
+				return false, false
 			}
 		default:
 			break
@@ -259,31 +418,41 @@ func (con *Consumer) processDeliveries(deliveryChan <-chan amqp.Delivery, chanHo
 
 		// Convert amqp.Delivery into our internal struct for later use.
 		select {
-		case delivery := <-deliveryChan: // all buffered deliveries are wiped on a channel close error
-
-			msg := NewReceivedMessage(
-				!con.autoAck,
-				delivery)
-
-			if action != nil {
-				action(msg)
-			} else {
-				con.receivedMessages <- msg
+		case delivery, ok := <-deliveryChan: // all buffered deliveries are wiped on a channel close error
+			if !ok {
+				return false, con.canceled(chanHost)
 			}
 
+			con.handleDelivery(delivery, action)
+
 		default:
+			con.flushDueBatch()
 			if con.sleepOnIdleInterval > 0 {
 				time.Sleep(con.sleepOnIdleInterval)
 			}
 			break
 		}
 
+		// Expire on every pass, a steady flow of deliveries never leaves the consumer idle.
+		con.expireChunks()
+
+		// Subscribe again to apply a changed adaptive prefetch.
+		if con.adaptPrefetch() {
+			con.resubscribing = true
+			return false, con.cancelSubscription(deliveryChan, chanHost, action)
+		}
+
 		// Detect if we should stop consuming.
 		select {
 		case stop := <-con.consumeStop:
 			if stop {
-				con.ConnectionPool.ReturnChannel(chanHost, false)
-				return true
+				con.flushBatch()
+				con.resetChunks()
+				return true, true // returned once the loop ends
+			}
+		case <-con.pauseSignal:
+			if con.Paused() {
+				return false, con.cancelSubscription(deliveryChan, chanHost, action)
 			}
 		default:
 			break
@@ -291,6 +460,32 @@ func (con *Consumer) processDeliveries(deliveryChan <-chan amqp.Delivery, chanHo
 	}
 }
 
+// handleDelivery converts the delivery into a ReceivedMessage and hands it to the action or ReceivedMessages.
+func (con *Consumer) handleDelivery(delivery amqp.Delivery, action func(*ReceivedMessage)) {
+
+	msg := NewReceivedMessage(
+		!con.autoAck,
+		delivery)
+
+	if msg = con.reassemble(msg); msg == nil {
+		return
+	}
+
+	con.deliverBatch(msg)
+
+	if !con.checkOut(msg) {
+		return
+	}
+
+	con.trackPrefetch(msg)
+
+	if action != nil {
+		action(msg)
+	} else {
+		con.receivedMessages <- msg
+	}
+}
+
 // StopConsuming allows you to signal stop to the consumer.
 // Will stop on the consumer channelclose or responding to signal after getting all remaining deviveries.
 // FlushMessages empties the internal buffer of messages received by queue. Ackable messages are still in
@@ -319,11 +514,26 @@ func (con *Consumer) ReceivedMessages() <-chan *ReceivedMessage {
 	return con.receivedMessages
 }
 
-// Errors yields all the internal errs for consuming messages.
+// Errors yields all the internal errs for consuming messages. Errors are sent without blocking the consume loop,
+// once 1000 are waiting to be read further ones are dropped and counted by DroppedErrors.
 func (con *Consumer) Errors() <-chan error {
 	return con.errors
 }
 
+// DroppedErrors returns the count of errors dropped because Errors wasn't read.
+func (con *Consumer) DroppedErrors() uint64 {
+	return atomic.LoadUint64(&con.droppedErrors)
+}
+
+// sendError sends the error to Errors without blocking, counting it as dropped when full.
+func (con *Consumer) sendError(err error) {
+	select {
+	case con.errors <- err:
+	default:
+		atomic.AddUint64(&con.droppedErrors, 1)
+	}
+}
+
 // FlushStop allows you to flush out all previous Stop signals.
 func (con *Consumer) FlushStop() {
 
@@ -0,0 +1,65 @@
+package tcr
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultCredentialsRefreshWindow = time.Duration(60) * time.Second
+
+// Credentials are the username and password (or token) used to authenticate a connection.
+type Credentials struct {
+	Username   string
+	Password   string
+	Expiration time.Time // zero value means the credentials don't expire
+}
+
+// CredentialsProvider is consulted on every dial and reconnect of a ConnectionHost, allowing
+// passwords or OAuth2 tokens to be refreshed without rebuilding the ConnectionPool.
+type CredentialsProvider func() (*Credentials, error)
+
+// EnvCredentialsProvider reads the username and password from environment variables on every dial.
+func EnvCredentialsProvider(usernameKey, passwordKey string) CredentialsProvider {
+	return func() (*Credentials, error) {
+
+		username, ok := os.LookupEnv(usernameKey)
+		if !ok {
+			return nil, errors.New("credentials username environment variable " + usernameKey + " is not set")
+		}
+
+		password, ok := os.LookupEnv(passwordKey)
+		if !ok {
+			return nil, errors.New("credentials password environment variable " + passwordKey + " is not set")
+		}
+
+		return &Credentials{
+			Username: username,
+			Password: password,
+		}, nil
+	}
+}
+
+// FileCredentialsProvider reads the username and password from files (ex. mounted secrets) on every dial.
+// Leading and trailing whitespace is trimmed from the file contents.
+func FileCredentialsProvider(usernameLocation, passwordLocation string) CredentialsProvider {
+	return func() (*Credentials, error) {
+
+		username, err := ioutil.ReadFile(usernameLocation)
+		if err != nil {
+			return nil, err
+		}
+
+		password, err := ioutil.ReadFile(passwordLocation)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Credentials{
+			Username: strings.TrimSpace(string(username)),
+			Password: strings.TrimSpace(string(password)),
+		}, nil
+	}
+}
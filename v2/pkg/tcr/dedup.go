@@ -0,0 +1,426 @@
+package tcr
+
+import (
+	"bufio"
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDedupTTL      = time.Duration(24) * time.Hour
+	defaultDedupCapacity = 100000
+	dedupFileName        = "dedup.log"
+)
+
+// DedupStore records the IDs of processed messages for a TTL, so redelivered duplicates can be skipped.
+type DedupStore interface {
+	// Seen returns true when the ID was recorded and hasn't expired.
+	Seen(id string) (bool, error)
+
+	// Mark records the ID as processed.
+	Mark(id string) error
+}
+
+// NewDedupStore creates a FileDedupStore when the DedupConfig has a Directory, otherwise a MemoryDedupStore.
+func NewDedupStore(config *DedupConfig) (DedupStore, error) {
+
+	ttl := defaultDedupTTL
+	capacity := defaultDedupCapacity
+	if config.TTL > 0 {
+		ttl = time.Duration(config.TTL) * time.Millisecond
+	}
+	if config.Capacity > 0 {
+		capacity = config.Capacity
+	}
+
+	if config.Directory != "" {
+		return NewFileDedupStore(config.Directory, capacity, ttl)
+	}
+
+	return NewMemoryDedupStore(capacity, ttl), nil
+}
+
+// Idempotent is consumer middleware skipping messages whose ID was already processed. The ID is the value of
+// the header, or the MessageID when the header is blank. Duplicates are acknowledged without calling next.
+// IDs are recorded once the message is acknowledged, whenever that happens (ex. by a batch or the reader of
+// ReceivedMessages), unless next returned an error. Auto-acked messages are recorded once next returns without one.
+// Messages nacked, rejected, failed or never acknowledged are processed again when redelivered.
+// Messages without an ID, and DedupStore errors, never stop a message from being processed.
+func Idempotent(store DedupStore, header string) Middleware {
+	return func(next Handler) Handler {
+		return func(msg *ReceivedMessage) error {
+
+			id := msg.MessageID
+			if header != "" {
+				id, _ = msg.Headers[header].(string)
+			}
+
+			if id == "" {
+				return next(msg)
+			}
+
+			if seen, err := store.Seen(id); err == nil && seen {
+				if msg.IsAckable {
+					return msg.Acknowledge()
+				}
+				return nil
+			}
+
+			if msg.IsAckable {
+				return markOnAck(store, id, msg, next)
+			}
+
+			if err := next(msg); err != nil {
+				return err
+			}
+
+			_ = store.Mark(id)
+			return nil
+		}
+	}
+}
+
+// markOnAck calls next, recording the ID when the message is acknowledged unless next failed. The message can be
+// acknowledged by next or after it returned, from any goroutine.
+func markOnAck(store DedupStore, id string, msg *ReceivedMessage, next Handler) error {
+
+	lock := &sync.Mutex{}
+	returned, failed, acked := false, false, false
+
+	onAck := msg.onAck
+	msg.onAck = func() {
+		if onAck != nil {
+			onAck()
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		acked = true
+		if returned && !failed {
+			_ = store.Mark(id)
+		}
+	}
+
+	err := next(msg)
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	returned, failed = true, err != nil
+	if acked && !failed {
+		_ = store.Mark(id)
+	}
+
+	return err
+}
+
+// UseDedup skips messages whose ID was already processed, adding the Idempotent middleware with a store created
+// from the DedupConfig. Nil or disabled does nothing. Set it before starting to consume.
+func (con *Consumer) UseDedup(config *DedupConfig) error {
+
+	if config == nil || !config.Enabled {
+		return nil
+	}
+
+	store, err := NewDedupStore(config)
+	if err != nil {
+		return err
+	}
+
+	con.UseMiddleware(Idempotent(store, config.Header))
+	return nil
+}
+
+// MemoryDedupStore is a DedupStore keeping up to a capacity of IDs in memory, evicting the least recently marked first.
+type MemoryDedupStore struct {
+	capacity  int
+	ttl       time.Duration
+	entries   map[string]*list.Element
+	order     *list.List // front is the most recently marked
+	storeLock *sync.Mutex
+}
+
+type dedupEntry struct {
+	id      string
+	expires time.Time
+}
+
+// NewMemoryDedupStore creates a MemoryDedupStore.
+func NewMemoryDedupStore(capacity int, ttl time.Duration) *MemoryDedupStore {
+	return &MemoryDedupStore{
+		capacity:  capacity,
+		ttl:       ttl,
+		entries:   make(map[string]*list.Element),
+		order:     list.New(),
+		storeLock: &sync.Mutex{},
+	}
+}
+
+// Seen returns true when the ID was recorded and hasn't expired.
+func (store *MemoryDedupStore) Seen(id string) (bool, error) {
+	store.storeLock.Lock()
+	defer store.storeLock.Unlock()
+
+	element, ok := store.entries[id]
+	if !ok {
+		return false, nil
+	}
+
+	if time.Now().After(element.Value.(*dedupEntry).expires) {
+		store.order.Remove(element)
+		delete(store.entries, id)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Mark records the ID as processed.
+func (store *MemoryDedupStore) Mark(id string) error {
+	store.markUntil(id, time.Now().Add(store.ttl))
+	return nil
+}
+
+func (store *MemoryDedupStore) markUntil(id string, expires time.Time) {
+	store.storeLock.Lock()
+	defer store.storeLock.Unlock()
+
+	if element, ok := store.entries[id]; ok {
+		element.Value.(*dedupEntry).expires = expires
+		store.order.MoveToFront(element)
+		return
+	}
+
+	store.entries[id] = store.order.PushFront(&dedupEntry{id: id, expires: expires})
+
+	for store.capacity > 0 && store.order.Len() > store.capacity {
+		oldest := store.order.Back()
+		store.order.Remove(oldest)
+		delete(store.entries, oldest.Value.(*dedupEntry).id)
+	}
+}
+
+// unexpired evicts the expired IDs and returns the rest, least recently marked first.
+func (store *MemoryDedupStore) unexpired(now time.Time) []*dedupEntry {
+	store.storeLock.Lock()
+	defer store.storeLock.Unlock()
+
+	entries := make([]*dedupEntry, 0, store.order.Len())
+	for element := store.order.Back(); element != nil; {
+		previous := element.Prev()
+
+		entry := element.Value.(*dedupEntry)
+		if now.After(entry.expires) {
+			store.order.Remove(element)
+			delete(store.entries, entry.id)
+		} else {
+			entries = append(entries, entry)
+		}
+
+		element = previous
+	}
+
+	return entries
+}
+
+// Len returns the count of IDs held, including expired ones not yet evicted.
+func (store *MemoryDedupStore) Len() int {
+	store.storeLock.Lock()
+	defer store.storeLock.Unlock()
+
+	return store.order.Len()
+}
+
+// FileDedupStore is a DedupStore surviving restarts, appending every ID to a log in the directory.
+// The IDs are also kept in memory, up to a capacity like the MemoryDedupStore. The log is compacted to the
+// unexpired IDs held when opened, and again whenever it grows to twice as many lines as IDs held.
+type FileDedupStore struct {
+	memory    *MemoryDedupStore
+	path      string
+	logged    int // lines in the log
+	file      *os.File
+	writer    *bufio.Writer
+	storeLock *sync.Mutex
+}
+
+// NewFileDedupStore opens (or creates) a FileDedupStore in the directory, a capacity of zero keeps every ID.
+func NewFileDedupStore(directory string, capacity int, ttl time.Duration) (*FileDedupStore, error) {
+
+	if directory == "" {
+		return nil, fmt.Errorf("dedup store directory can't be blank")
+	}
+
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, err
+	}
+
+	store := &FileDedupStore{
+		memory:    NewMemoryDedupStore(capacity, ttl),
+		path:      filepath.Join(directory, dedupFileName),
+		storeLock: &sync.Mutex{},
+	}
+
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+
+	if err := store.compact(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// load reads the unexpired IDs of the log, a torn last line is ignored.
+func (store *FileDedupStore) load() error {
+
+	file, err := os.Open(store.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	now := time.Now()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		expiresNano, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		if expires := time.Unix(0, expiresNano); expires.After(now) {
+			store.memory.markUntil(fields[1], expires)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// compact rewrites the log with the unexpired IDs held, oldest first, and keeps it open for appending.
+func (store *FileDedupStore) compact() error {
+
+	if store.file != nil {
+		err := store.writer.Flush()
+		if closeErr := store.file.Close(); err == nil {
+			err = closeErr
+		}
+		store.file = nil
+		if err != nil {
+			return err
+		}
+	}
+
+	temp := store.path + ".tmp"
+	file, err := os.OpenFile(temp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	entries := store.memory.unexpired(time.Now())
+	writer := bufio.NewWriter(file)
+	for _, entry := range entries {
+		if _, err := fmt.Fprintf(writer, "%d %s\n", entry.expires.UnixNano(), entry.id); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(temp, store.path); err != nil {
+		return err
+	}
+
+	store.file, err = os.OpenFile(store.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	store.writer = bufio.NewWriter(store.file)
+	store.logged = len(entries)
+	return nil
+}
+
+// Seen returns true when the ID was recorded and hasn't expired.
+func (store *FileDedupStore) Seen(id string) (bool, error) {
+	return store.memory.Seen(id)
+}
+
+// Mark records the ID as processed, flushing it to the log.
+func (store *FileDedupStore) Mark(id string) error {
+
+	if strings.ContainsAny(id, "\r\n") {
+		return fmt.Errorf("invalid dedup id %q", id)
+	}
+
+	store.storeLock.Lock()
+	defer store.storeLock.Unlock()
+
+	if store.file == nil {
+		return fmt.Errorf("dedup store is closed")
+	}
+
+	expires := time.Now().Add(store.memory.ttl)
+	store.memory.markUntil(id, expires)
+
+	if _, err := fmt.Fprintf(store.writer, "%d %s\n", expires.UnixNano(), id); err != nil {
+		return err
+	}
+
+	if err := store.writer.Flush(); err != nil {
+		return err
+	}
+
+	store.logged++
+
+	// Evicted, expired and marked again IDs pile up in the log, compact once they outnumber the IDs held.
+	held := store.memory.Len()
+	if store.memory.capacity > held {
+		held = store.memory.capacity
+	}
+	if store.logged >= 2*held {
+		return store.compact()
+	}
+
+	return nil
+}
+
+// Close flushes and closes the log.
+func (store *FileDedupStore) Close() error {
+	store.storeLock.Lock()
+	defer store.storeLock.Unlock()
+
+	if store.file == nil {
+		return nil
+	}
+
+	err := store.writer.Flush()
+	if closeErr := store.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	store.file = nil
+	return err
+}
@@ -0,0 +1,552 @@
+package tcr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+var (
+	// ErrPublishNacked is the PublishFuture error when the server nacks the letter.
+	ErrPublishNacked = errors.New("publish was nacked by the server")
+
+	// ErrPublishReturned is the PublishFuture error when a mandatory or immediate letter couldn't be routed.
+	ErrPublishReturned = errors.New("publish was returned by the server")
+
+	// ErrPublishTimeout is the PublishFuture error when the confirmation didn't arrive in time.
+	ErrPublishTimeout = errors.New("publish confirmation wasn't received in a timely manner")
+
+	// ErrPublisherShutdown is the PublishFuture error when the Publisher has been shutdown.
+	ErrPublisherShutdown = errors.New("publisher has been shutdown")
+)
+
+const asyncPublishTimeoutInterval = time.Duration(10) * time.Millisecond
+
+// PublishFuture resolves once the letter published with PublishAsync is confirmed, nacked, returned or times out.
+type PublishFuture struct {
+	Letter     *Letter
+	done       chan struct{}
+	receipt    *PublishReceipt
+	callbacks  []func(*PublishReceipt)
+	futureLock *sync.Mutex
+}
+
+func newPublishFuture(letter *Letter) *PublishFuture {
+	return &PublishFuture{
+		Letter:     letter,
+		done:       make(chan struct{}),
+		futureLock: &sync.Mutex{},
+	}
+}
+
+// Done is closed once the PublishFuture has resolved.
+func (future *PublishFuture) Done() <-chan struct{} {
+	return future.done
+}
+
+// Wait blocks until the PublishFuture has resolved and returns the error, nil when the server confirmed the letter.
+func (future *PublishFuture) Wait() error {
+	<-future.done
+	return future.receipt.Error
+}
+
+// Receipt returns the PublishReceipt once resolved, nil before then.
+func (future *PublishFuture) Receipt() *PublishReceipt {
+	future.futureLock.Lock()
+	defer future.futureLock.Unlock()
+
+	return future.receipt
+}
+
+// OnComplete registers a callback invoked with the PublishReceipt once resolved, or right away when already resolved.
+// Callbacks run on the publishing goroutine, keep them quick.
+func (future *PublishFuture) OnComplete(callback func(*PublishReceipt)) {
+	future.futureLock.Lock()
+
+	if future.receipt == nil {
+		future.callbacks = append(future.callbacks, callback)
+		future.futureLock.Unlock()
+		return
+	}
+
+	receipt := future.receipt
+	future.futureLock.Unlock()
+
+	callback(receipt)
+}
+
+func (future *PublishFuture) resolve(err error, returned *amqp.Return) {
+	future.futureLock.Lock()
+
+	if future.receipt != nil {
+		future.futureLock.Unlock()
+		return
+	}
+
+	receipt := &PublishReceipt{
+		LetterID: future.Letter.LetterID,
+		Error:    err,
+		Returned: returned,
+	}
+
+	if err == nil {
+		receipt.Success = true
+	} else {
+		receipt.FailedLetter = future.Letter
+	}
+
+	future.receipt = receipt
+	callbacks := future.callbacks
+	future.callbacks = nil
+	close(future.done)
+	future.futureLock.Unlock()
+
+	for _, callback := range callbacks {
+		callback(receipt)
+	}
+}
+
+// asyncPublish is a letter waiting to be published, or confirmed, by the async publishing loop.
+type asyncPublish struct {
+	ctx       context.Context
+	letter    *Letter // as published, ex. after a claim check
+	messageID string  // as published, returns are matched on it with the exchange and routing key
+	future    *PublishFuture
+	deadline  time.Time
+	returned  *amqp.Return
+}
+
+// PublishAsync publishes the letter with confirmation without waiting, the PublishFuture resolves with the outcome.
+// The confirmation is awaited until the context is done or the Publisher's publish timeout expires, whichever is first.
+// Letters are pipelined on a single dedicated confirm channel so there is no goroutine per letter.
+// Outcomes are not sent to PublishReceipts, use Wait, Done or OnComplete instead.
+func (pub *Publisher) PublishAsync(ctx context.Context, letter *Letter) *PublishFuture {
+
+	future := newPublishFuture(letter)
+	request := &asyncPublish{
+		ctx:    ctx,
+		future: future,
+	}
+
+	if pub.publishTimeOutDuration > 0 {
+		request.deadline = time.Now().Add(pub.publishTimeOutDuration)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && (request.deadline.IsZero() || deadline.Before(request.deadline)) {
+		request.deadline = deadline
+	}
+
+	if pub.intakeClosed() {
+		future.resolve(ErrPublisherShutdown, nil)
+		return future
+	}
+
+	prepared, done, err := pub.prepare(ctx, letter, false)
+	if err != nil {
+		future.resolve(err, nil)
+		return future
+	}
+	request.letter = prepared
+	future.OnComplete(func(receipt *PublishReceipt) { done(receipt.Error) })
+
+	// Chunks need their own confirm batch, off the pipelined channel.
+	if chunks := pub.splitLetter(prepared); chunks != nil {
+		go func() {
+			future.resolve(pub.publishChunks(ctx, chunks, 0), nil)
+		}()
+		return future
+	}
+
+	pub.startAsyncPublishing()
+
+	select {
+	case pub.asyncLetters <- request:
+	case <-ctx.Done():
+		future.resolve(ctx.Err(), nil)
+	}
+
+	return future
+}
+
+func (pub *Publisher) startAsyncPublishing() {
+	pub.pubLock.Lock()
+	defer pub.pubLock.Unlock()
+
+	if pub.asyncStarted {
+		return
+	}
+
+	pub.asyncStarted = true
+	pub.asyncStop = make(chan struct{})
+	pub.asyncStopOnce = &sync.Once{}
+	pub.asyncDone = make(chan struct{})
+
+	go pub.asyncPublishLoop(pub.asyncStop, pub.asyncDone)
+}
+
+// drainAsyncPublishing waits for the letters given to PublishAsync to be confirmed, until the context is done.
+// Returns the letters that weren't delivered.
+func (pub *Publisher) drainAsyncPublishing(ctx context.Context) []*Letter {
+
+	pub.pubLock.Lock()
+	started, done := pub.asyncStarted, pub.asyncDone
+	pub.pubLock.Unlock()
+
+	if !started {
+		return nil
+	}
+
+	drain := &publisherDrain{
+		ctx:         ctx,
+		undelivered: make(chan []*Letter, 1),
+	}
+
+	// The loop may exit on a stop before taking the drain.
+	var undelivered []*Letter
+	select {
+	case pub.asyncDrain <- drain:
+		select {
+		case undelivered = <-drain.undelivered:
+		case <-done:
+		}
+	case <-done:
+	}
+
+	<-done
+	select {
+	case <-pub.asyncDrain:
+	default:
+	}
+
+	pub.asyncStopped(done)
+	return undelivered
+}
+
+// stopAsyncPublishing stops the async publishing loop, failing the letters still awaiting confirmation
+// or waiting to be published.
+func (pub *Publisher) stopAsyncPublishing() {
+
+	pub.pubLock.Lock()
+	if !pub.asyncStarted {
+		pub.pubLock.Unlock()
+		return
+	}
+
+	done := pub.asyncDone
+	pub.asyncStopOnce.Do(func() { close(pub.asyncStop) })
+	pub.pubLock.Unlock()
+
+	// Waited on without the lock, the loop doesn't need it but everything else publishing does.
+	<-done
+	pub.asyncStopped(done)
+}
+
+// asyncStopped marks the async publishing loop that closed done as stopped, unless another one was started since.
+// Letters given to PublishAsync while it was stopping are failed, nothing is going to publish them.
+func (pub *Publisher) asyncStopped(done chan struct{}) {
+	pub.pubLock.Lock()
+	defer pub.pubLock.Unlock()
+
+	if pub.asyncDone == done {
+		pub.asyncStarted = false
+		pub.failAsyncLetters(ErrPublisherShutdown)
+	}
+}
+
+// asyncChannel is the dedicated confirm channel used by the async publishing loop.
+type asyncChannel struct {
+	channel       *amqp.Channel
+	confirmations chan amqp.Confirmation
+	returns       chan amqp.Return
+	errors        chan *amqp.Error
+	deliveryTag   uint64
+	pending       map[uint64]*asyncPublish
+}
+
+// acquireAsyncChannel gets a confirm channel in the background, the pool retries until the broker is reachable.
+// The async publishing loop keeps answering stops and drains meanwhile.
+func (pub *Publisher) acquireAsyncChannel() <-chan *amqp.Channel {
+
+	acquired := make(chan *amqp.Channel, 1)
+	go func() {
+		acquired <- pub.ConnectionPool.GetTransientChannel(true)
+	}()
+
+	return acquired
+}
+
+// closeAcquiredChannel closes the channel still being acquired once it's there, the loop no longer needs it.
+func closeAcquiredChannel(acquiring <-chan *amqp.Channel) {
+	if acquiring != nil {
+		go func() {
+			channel := <-acquiring
+			channel.Close()
+		}()
+	}
+}
+
+func newAsyncChannel(channel *amqp.Channel) *asyncChannel {
+	return &asyncChannel{
+		channel:       channel,
+		confirmations: channel.NotifyPublish(make(chan amqp.Confirmation, 1000)),
+		returns:       channel.NotifyReturn(make(chan amqp.Return, 100)),
+		errors:        channel.NotifyClose(make(chan *amqp.Error, 1)),
+		pending:       make(map[uint64]*asyncPublish),
+	}
+}
+
+func (pub *Publisher) asyncPublishLoop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(asyncPublishTimeoutInterval)
+	defer ticker.Stop()
+
+	var async *asyncChannel
+	var acquiring <-chan *amqp.Channel
+	var drain *publisherDrain
+	var drained []*asyncPublish // every letter handled since the drain started
+	for {
+		if drain != nil && len(pub.asyncLetters) == 0 && (async == nil || len(async.pending) == 0) {
+			if async != nil {
+				async.channel.Close()
+			}
+			closeAcquiredChannel(acquiring)
+
+			drain.undelivered <- undeliveredLetters(drained)
+			return
+		}
+
+		if async == nil && acquiring == nil {
+			acquiring = pub.acquireAsyncChannel()
+		}
+
+		var drainDone <-chan struct{}
+		if drain != nil {
+			drainDone = drain.ctx.Done()
+		}
+
+		// Letters wait in asyncLetters until there is a channel to publish them on.
+		var letters <-chan *asyncPublish
+		var confirmations <-chan amqp.Confirmation
+		var returns <-chan amqp.Return
+		var errs <-chan *amqp.Error
+		if async != nil {
+			letters = pub.asyncLetters
+			confirmations = async.confirmations
+			returns = async.returns
+			errs = async.errors
+		}
+
+		select {
+		case <-stop:
+			if async != nil {
+				async.failPending(ErrPublisherShutdown)
+				async.channel.Close()
+			}
+			closeAcquiredChannel(acquiring)
+			pub.failAsyncLetters(ErrPublisherShutdown)
+			return
+
+		case channel := <-acquiring:
+			acquiring = nil
+			async = newAsyncChannel(channel)
+
+		case drain = <-pub.asyncDrain:
+			if async != nil {
+				for _, request := range async.pending {
+					drained = append(drained, request)
+				}
+			}
+
+		case <-drainDone:
+			if async != nil {
+				async.failPending(drain.ctx.Err())
+				async.channel.Close()
+			}
+			closeAcquiredChannel(acquiring)
+
+			drained = append(drained, pub.failAsyncLetters(drain.ctx.Err())...)
+
+			drain.undelivered <- undeliveredLetters(drained)
+			return
+
+		case request := <-letters:
+			if drain != nil {
+				drained = append(drained, request)
+			}
+
+			if !async.publish(pub, request) {
+				async.channel.Close()
+				async = nil
+			}
+
+		case confirmation := <-confirmations:
+			// A return always precedes the confirmation of the same letter.
+			async.drainReturns()
+			async.confirm(confirmation)
+
+		case returned := <-returns:
+			async.recordReturn(returned)
+
+		case amqpErr := <-errs:
+			err := errors.New("channel closed before the publish was confirmed")
+			if amqpErr != nil {
+				err = amqpErr
+			}
+
+			async.failPending(err)
+			async = nil
+
+		case <-ticker.C:
+			if async != nil {
+				async.expirePending(time.Now())
+			}
+		}
+	}
+}
+
+// failAsyncLetters resolves the letters still waiting in asyncLetters with the error, returning them.
+func (pub *Publisher) failAsyncLetters(err error) []*asyncPublish {
+
+	failed := make([]*asyncPublish, 0)
+	for {
+		select {
+		case request := <-pub.asyncLetters:
+			request.future.resolve(err, nil)
+			failed = append(failed, request)
+		default:
+			return failed
+		}
+	}
+}
+
+// undeliveredLetters returns the letters of the resolved requests that failed.
+func undeliveredLetters(requests []*asyncPublish) []*Letter {
+
+	letters := make([]*Letter, 0)
+	for _, request := range requests {
+		if receipt := request.future.Receipt(); receipt == nil || receipt.Error != nil {
+			letters = append(letters, request.future.Letter)
+		}
+	}
+
+	return letters
+}
+
+// publish publishes the letter without waiting on the confirmation. Returns false when the channel is no longer usable.
+func (async *asyncChannel) publish(pub *Publisher, request *asyncPublish) bool {
+
+	if err := request.ctx.Err(); err != nil {
+		request.future.resolve(err, nil)
+		return true
+	}
+
+	letter := request.letter
+	publishing := pub.createPublishing(letter)
+	err := async.channel.Publish(
+		letter.Envelope.Exchange,
+		letter.Envelope.RoutingKey,
+		letter.Envelope.Mandatory,
+		letter.Envelope.Immediate,
+		publishing,
+	)
+	if err != nil {
+		request.future.resolve(err, nil)
+		async.failPending(err)
+		return false
+	}
+
+	async.deliveryTag++
+	request.messageID = publishing.MessageId
+	async.pending[async.deliveryTag] = request
+
+	return true
+}
+
+func (async *asyncChannel) confirm(confirmation amqp.Confirmation) {
+
+	request, ok := async.pending[confirmation.DeliveryTag]
+	if !ok {
+		return // already expired
+	}
+
+	delete(async.pending, confirmation.DeliveryTag)
+
+	switch {
+	case !confirmation.Ack:
+		request.future.resolve(ErrPublishNacked, request.returned)
+	case request.returned != nil:
+		request.future.resolve(
+			fmt.Errorf("%w: %d %s", ErrPublishReturned, request.returned.ReplyCode, request.returned.ReplyText),
+			request.returned)
+	default:
+		request.future.resolve(nil, nil)
+	}
+}
+
+func (async *asyncChannel) drainReturns() {
+	for {
+		select {
+		case returned := <-async.returns:
+			async.recordReturn(returned)
+		default:
+			return
+		}
+	}
+}
+
+// recordReturn matches the return to the pending mandatory (or immediate) letter published with its MessageId, exchange
+// and routing key. Returns arrive in publishing order, so several such pending letters get them earliest first.
+func (async *asyncChannel) recordReturn(returned amqp.Return) {
+
+	var match uint64
+	for deliveryTag, request := range async.pending {
+		if request.returned != nil || !request.returns(returned) {
+			continue
+		}
+
+		if match == 0 || deliveryTag < match {
+			match = deliveryTag
+		}
+	}
+
+	if match != 0 {
+		async.pending[match].returned = &returned
+	}
+}
+
+// returns is true when the return could be for the letter. Letters neither mandatory nor immediate are never returned.
+func (request *asyncPublish) returns(returned amqp.Return) bool {
+
+	envelope := request.letter.Envelope
+	return (envelope.Mandatory || envelope.Immediate) &&
+		request.messageID == returned.MessageId &&
+		envelope.Exchange == returned.Exchange &&
+		envelope.RoutingKey == returned.RoutingKey
+}
+
+func (async *asyncChannel) expirePending(now time.Time) {
+	for deliveryTag, request := range async.pending {
+		if err := request.ctx.Err(); err != nil {
+			delete(async.pending, deliveryTag)
+			request.future.resolve(err, nil)
+			continue
+		}
+
+		if !request.deadline.IsZero() && now.After(request.deadline) {
+			delete(async.pending, deliveryTag)
+			request.future.resolve(ErrPublishTimeout, nil)
+		}
+	}
+}
+
+func (async *asyncChannel) failPending(err error) {
+	for deliveryTag, request := range async.pending {
+		delete(async.pending, deliveryTag)
+		request.future.resolve(err, nil)
+	}
+}
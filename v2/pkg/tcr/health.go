@@ -0,0 +1,179 @@
+package tcr
+
+import (
+	"net/http"
+	"time"
+)
+
+const defaultMaxRecoveryInterval = time.Duration(60) * time.Second
+
+// Stats is a point in time snapshot of the internal state of a ConnectionPool or RabbitService.
+type Stats struct {
+	ConnectionsTotal      uint64        `json:"ConnectionsTotal"`
+	ConnectionsOpen       uint64        `json:"ConnectionsOpen"`
+	ConnectionsFlagged    uint64        `json:"ConnectionsFlagged"`
+	ConnectionsRecovering uint64        `json:"ConnectionsRecovering"`
+	LongestRecovery       time.Duration `json:"LongestRecovery"`
+	ChannelsIdle          uint64        `json:"ChannelsIdle"`
+	ChannelsInUse         uint64        `json:"ChannelsInUse"`
+	ConsumersTotal        uint64        `json:"ConsumersTotal"`
+	ConsumersRunning      uint64        `json:"ConsumersRunning"`
+	LastError             string        `json:"LastError,omitempty"`
+	LastErrorTime         time.Time     `json:"LastErrorTime"`
+}
+
+// Health summarizes Stats into liveness and readiness for use with probes.
+// Live is false when a connection has been stuck recovering longer than PoolConfig.MaxRecoveryInterval.
+// Ready is false when there isn't a single open connection to work with.
+type Health struct {
+	Live   bool   `json:"Live"`
+	Ready  bool   `json:"Ready"`
+	Reason string `json:"Reason,omitempty"`
+	Stats  *Stats `json:"Stats"`
+}
+
+// Stats returns a snapshot of connections, channels and the last error seen by the ConnectionPool.
+func (cp *ConnectionPool) Stats() *Stats {
+
+	stats := &Stats{}
+
+	cp.poolRWLock.RLock()
+	connectionHosts := cp.connectionHosts
+	for _, flagged := range cp.flaggedConnections {
+		if flagged {
+			stats.ConnectionsFlagged++
+		}
+	}
+	lastError, lastErrorTime := cp.lastError, cp.lastErrorTime
+	channelCount := cp.channels.count + cp.nonConfirmChannels.count
+	cp.poolRWLock.RUnlock()
+
+	now := time.Now()
+	for _, connHost := range connectionHosts {
+		stats.ConnectionsTotal++
+
+		if connHost.IsOpen() {
+			stats.ConnectionsOpen++
+		}
+
+		if recovering, since := connHost.Recovering(); recovering {
+			stats.ConnectionsRecovering++
+			if now.Sub(since) > stats.LongestRecovery {
+				stats.LongestRecovery = now.Sub(since)
+			}
+		}
+
+		if connErr := connHost.LastError(); connErr != nil && connHost.LastErrorTime().After(lastErrorTime) {
+			lastError, lastErrorTime = connErr, connHost.LastErrorTime()
+		}
+	}
+
+	stats.ChannelsIdle = uint64(len(cp.channels.idle) + len(cp.nonConfirmChannels.idle))
+	if channelCount > stats.ChannelsIdle {
+		stats.ChannelsInUse = channelCount - stats.ChannelsIdle
+	}
+
+	if lastError != nil {
+		stats.LastError = lastError.Error()
+		stats.LastErrorTime = lastErrorTime
+	}
+
+	return stats
+}
+
+// Health returns the liveness and readiness of the ConnectionPool.
+func (cp *ConnectionPool) Health() *Health {
+	return cp.healthFromStats(cp.Stats())
+}
+
+func (cp *ConnectionPool) healthFromStats(stats *Stats) *Health {
+
+	health := &Health{
+		Live:  true,
+		Ready: true,
+		Stats: stats,
+	}
+
+	maxRecoveryInterval := cp.maxRecoveryInterval
+	if maxRecoveryInterval == 0 {
+		maxRecoveryInterval = defaultMaxRecoveryInterval
+	}
+
+	if stats.ConnectionsOpen == 0 {
+		health.Ready = false
+		health.Reason = "no open connections"
+	}
+
+	if stats.LongestRecovery > maxRecoveryInterval {
+		health.Live = false
+		health.Reason = "connection recovery exceeded " + maxRecoveryInterval.String()
+	}
+
+	return health
+}
+
+// Stats returns a snapshot of the ConnectionPool along with the state of the consumers.
+func (rs *RabbitService) Stats() *Stats {
+
+	stats := rs.ConnectionPool.Stats()
+
+	rs.serviceLock.Lock()
+	defer rs.serviceLock.Unlock()
+
+	for _, consumer := range rs.consumers {
+		stats.ConsumersTotal++
+		if consumer.Started() {
+			stats.ConsumersRunning++
+		}
+	}
+
+	return stats
+}
+
+// Health returns the liveness and readiness of the RabbitService.
+// The service is not ready once shutdown has been triggered.
+func (rs *RabbitService) Health() *Health {
+
+	health := rs.ConnectionPool.healthFromStats(rs.Stats())
+	if rs.shutdown {
+		health.Ready = false
+		health.Reason = "service shutdown triggered"
+	}
+
+	return health
+}
+
+// LivenessHandler creates a net/http handler that responds 200 when live and 503 otherwise.
+// Example.) http.Handle("/healthz", tcr.LivenessHandler(rabbitService.Health))
+func LivenessHandler(health func() *Health) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := health()
+		writeHealth(w, h, h.Live)
+	})
+}
+
+// ReadinessHandler creates a net/http handler that responds 200 when live and ready and 503 otherwise.
+// Example.) http.Handle("/readyz", tcr.ReadinessHandler(rabbitService.Health))
+func ReadinessHandler(health func() *Health) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := health()
+		writeHealth(w, h, h.Live && h.Ready)
+	})
+}
+
+func writeHealth(w http.ResponseWriter, health *Health, ok bool) {
+
+	w.Header().Set("Content-Type", "application/json")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	data, err := json.Marshal(health)
+	if err != nil {
+		return
+	}
+
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,145 @@
+package tcr
+
+import (
+	"sync/atomic"
+)
+
+// LetterPriority selects the auto-publisher lane a queued letter waits in.
+// Unrelated to the AMQP Envelope Priority, which only matters inside the broker.
+type LetterPriority int
+
+const (
+	// PriorityHigh is for critical letters (ex. commands) that shouldn't wait behind anything else.
+	PriorityHigh LetterPriority = iota
+	// PriorityNormal is the lane used by QueueLetter(s).
+	PriorityNormal
+	// PriorityLow is for bulk letters (ex. telemetry) that can wait.
+	PriorityLow
+)
+
+const defaultLaneCapacity = 1000
+
+var defaultLaneWeights = []uint32{6, 3, 1}
+
+// String returns the name of the priority.
+func (priority LetterPriority) String() string {
+	switch priority {
+	case PriorityHigh:
+		return "High"
+	case PriorityNormal:
+		return "Normal"
+	case PriorityLow:
+		return "Low"
+	default:
+		return "Unknown"
+	}
+}
+
+// LaneStats is a point in time snapshot of one priority lane of the auto-publisher.
+type LaneStats struct {
+	Priority LetterPriority `json:"Priority"`
+	Weight   uint32         `json:"Weight"`
+	Capacity int            `json:"Capacity"`
+	Queued   int            `json:"Queued"`
+	Enqueued uint64         `json:"Enqueued"`
+	Dequeued uint64         `json:"Dequeued"`
+}
+
+// publishLane buffers the queued letters of one priority.
+type publishLane struct {
+	priority LetterPriority
+	letters  chan *Letter
+	weight   uint32
+	credits  uint32 // letters left to hand out this round, only touched by the auto-publishing loop
+	enqueued uint64
+	dequeued uint64
+}
+
+// newPublishLanes creates the lanes, highest priority first, with the weights and capacities of the PublisherConfig.
+func newPublishLanes(config *PublisherConfig) []*publishLane {
+
+	var laneConfigs []*LaneConfig
+	if config != nil {
+		laneConfigs = []*LaneConfig{config.HighPriorityLane, config.NormalPriorityLane, config.LowPriorityLane}
+	}
+
+	lanes := make([]*publishLane, 0, len(defaultLaneWeights))
+	for i, weight := range defaultLaneWeights {
+		capacity := defaultLaneCapacity
+
+		if laneConfigs != nil && laneConfigs[i] != nil {
+			if laneConfigs[i].Weight > 0 {
+				weight = laneConfigs[i].Weight
+			}
+			if laneConfigs[i].Capacity > 0 {
+				capacity = int(laneConfigs[i].Capacity)
+			}
+		}
+
+		lanes = append(lanes, &publishLane{
+			priority: LetterPriority(i),
+			letters:  make(chan *Letter, capacity),
+			weight:   weight,
+			credits:  weight,
+		})
+	}
+
+	return lanes
+}
+
+// lane returns the lane for the priority, unknown priorities use the normal lane.
+func (pub *Publisher) lane(priority LetterPriority) *publishLane {
+
+	if priority < PriorityHigh || int(priority) >= len(pub.lanes) {
+		return pub.lanes[PriorityNormal]
+	}
+
+	return pub.lanes[priority]
+}
+
+// nextLetter dequeues with weighted round robin: per round each lane hands out up to its weight in letters,
+// higher lanes first. An empty lane forfeits the rest of its turn so it can't hold up the others.
+func (pub *Publisher) nextLetter() (*Letter, bool) {
+
+	for round := 0; round < 2; round++ {
+		for _, lane := range pub.lanes {
+			if lane.credits == 0 {
+				continue
+			}
+
+			select {
+			case letter := <-lane.letters:
+				lane.credits--
+				atomic.AddUint64(&lane.dequeued, 1)
+				return letter, true
+			default:
+				lane.credits = 0
+			}
+		}
+
+		// Start a new round.
+		for _, lane := range pub.lanes {
+			lane.credits = lane.weight
+		}
+	}
+
+	return nil, false
+}
+
+// LaneStats returns a snapshot of every priority lane, highest priority first.
+func (pub *Publisher) LaneStats() []*LaneStats {
+
+	stats := make([]*LaneStats, 0, len(pub.lanes))
+	for _, lane := range pub.lanes {
+		stats = append(stats, &LaneStats{
+			Priority: lane.priority,
+			Weight:   lane.weight,
+			Capacity: cap(lane.letters),
+			Queued:   len(lane.letters),
+			Enqueued: atomic.LoadUint64(&lane.enqueued),
+			Dequeued: atomic.LoadUint64(&lane.dequeued),
+		})
+	}
+
+	return stats
+}
@@ -1,6 +1,8 @@
 package tcr
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/streadway/amqp"
 )
@@ -13,18 +15,25 @@ type Letter struct {
 	Envelope   *Envelope
 }
 
-// Envelope contains all the address details of where a letter is going.
+// Envelope contains all the address details of where a letter is going, along with its AMQP properties.
 type Envelope struct {
-	Exchange      string
-	RoutingKey    string
-	ContentType   string
-	CorrelationID string
-	Type          string
-	Mandatory     bool
-	Immediate     bool
-	Headers       amqp.Table
-	DeliveryMode  uint8
-	Priority      uint8
+	Exchange        string
+	RoutingKey      string
+	ContentType     string
+	ContentEncoding string
+	CorrelationID   string
+	Type            string
+	Mandatory       bool
+	Immediate       bool
+	Headers         amqp.Table
+	DeliveryMode    uint8
+	Priority        uint8
+	Expiration      string    // per message TTL in milliseconds, ex. "60000"
+	ReplyTo         string    // queue (or amq.rabbitmq.reply-to) for the response
+	MessageID       string    // blank uses the LetterID
+	Timestamp       time.Time // zero value uses the time of publishing
+	UserID          string    // validated by the server against the connection's user
+	AppID           string    // blank uses the PoolConfig ApplicationName
 }
 
 // WrappedBody is to go inside a Letter struct with indications of the body of data being modified (ex., compressed).
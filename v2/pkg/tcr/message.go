@@ -1,6 +1,7 @@
 package tcr
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -15,6 +16,7 @@ type PublishReceipt struct {
 	FailedLetter *Letter
 	Success      bool
 	Error        error
+	Returned     *amqp.Return // set when the server returned the letter as unroutable
 }
 
 // ToString allows you to quickly log the PublishReceipt struct as a string.
@@ -28,12 +30,30 @@ func (not *PublishReceipt) ToString() string {
 
 // ReceivedMessage allow for you to acknowledge, after processing the received payload, by its RabbitMQ tag and Channel pointer.
 type ReceivedMessage struct {
-	IsAckable     bool
-	Body          []byte
-	MessageID     string // LetterID
-	ApplicationID string
-	PublishDate   string
-	Delivery      amqp.Delivery // Access everything.
+	IsAckable       bool
+	Body            []byte
+	MessageID       string // LetterID
+	ApplicationID   string
+	PublishDate     string
+	ContentType     string
+	ContentEncoding string
+	CorrelationID   string
+	ReplyTo         string
+	Expiration      string
+	UserID          string
+	Type            string
+	Timestamp       time.Time
+	Headers         amqp.Table
+	DeliveryMode    uint8
+	Priority        uint8
+	Delivery        amqp.Delivery // Access everything.
+	claimCheck      *ClaimCheck
+	claimKey        string
+	chunks          []amqp.Delivery // the other chunks of a reassembled message
+	onAck           func()          // records the acknowledgement, ex. the ID for the Idempotent middleware, nil when unused
+	onSettle        func()          // reports the settlement to the adaptive prefetch, nil when not tracked
+	settled         bool
+	ctx             context.Context
 }
 
 // NewReceivedMessage creates a new ReceivedMessage.
@@ -42,12 +62,23 @@ func NewReceivedMessage(
 	delivery amqp.Delivery) *ReceivedMessage {
 
 	return &ReceivedMessage{
-		IsAckable:     isAckable,
-		Body:          delivery.Body,
-		MessageID:     delivery.MessageId,
-		ApplicationID: delivery.AppId,
-		PublishDate:   JSONUtcTimestampFromTime(delivery.Timestamp),
-		Delivery:      delivery,
+		IsAckable:       isAckable,
+		Body:            delivery.Body,
+		MessageID:       delivery.MessageId,
+		ApplicationID:   delivery.AppId,
+		PublishDate:     JSONUtcTimestampFromTime(delivery.Timestamp),
+		ContentType:     delivery.ContentType,
+		ContentEncoding: delivery.ContentEncoding,
+		CorrelationID:   delivery.CorrelationId,
+		ReplyTo:         delivery.ReplyTo,
+		Expiration:      delivery.Expiration,
+		UserID:          delivery.UserId,
+		Type:            delivery.Type,
+		Timestamp:       delivery.Timestamp,
+		Headers:         delivery.Headers,
+		DeliveryMode:    delivery.DeliveryMode,
+		Priority:        delivery.Priority,
+		Delivery:        delivery,
 	}
 }
 
@@ -63,7 +94,62 @@ func (msg *ReceivedMessage) Acknowledge() error {
 		return errors.New("can't acknowledge, internal channel is nil")
 	}
 
-	return msg.Delivery.Acknowledger.Ack(msg.Delivery.DeliveryTag, false)
+	for _, chunk := range msg.chunks {
+		if err := chunk.Ack(false); err != nil {
+			return err
+		}
+	}
+
+	if err := msg.Delivery.Acknowledger.Ack(msg.Delivery.DeliveryTag, false); err != nil {
+		return err
+	}
+
+	msg.acked()
+
+	return nil
+}
+
+// acked reports the message was acknowledged, removing its claim checked body and settling it.
+func (msg *ReceivedMessage) acked() {
+	msg.deleteClaim()
+	if msg.onAck != nil {
+		msg.onAck()
+	}
+	msg.settle()
+}
+
+// settle reports the message was settled, once it's acked, nacked or rejected.
+func (msg *ReceivedMessage) settle() {
+	msg.settled = true
+	if msg.onSettle != nil {
+		msg.onSettle()
+	}
+}
+
+// deliveries returns the delivery of the message along with those of its other chunks.
+func (msg *ReceivedMessage) deliveries() []amqp.Delivery {
+	return append([]amqp.Delivery{msg.Delivery}, msg.chunks...)
+}
+
+// Settled returns true once the message was acknowledged, nacked or rejected.
+func (msg *ReceivedMessage) Settled() bool {
+	return msg.settled
+}
+
+// Context returns the context of the message handling, ex. carrying the deadline of the Timeout middleware.
+// Never nil, defaults to the background context.
+func (msg *ReceivedMessage) Context() context.Context {
+	if msg.ctx == nil {
+		return context.Background()
+	}
+	return msg.ctx
+}
+
+// deleteClaim deletes the checked out body of an acknowledged message, best effort.
+func (msg *ReceivedMessage) deleteClaim() {
+	if msg.claimCheck != nil {
+		_ = msg.claimCheck.Store.Delete(context.Background(), msg.claimKey)
+	}
 }
 
 // Nack allows for you to negative acknowledge message on the original channel it was received.
@@ -77,7 +163,18 @@ func (msg *ReceivedMessage) Nack(requeue bool) error {
 		return errors.New("can't nack, internal channel is nil")
 	}
 
-	return msg.Delivery.Acknowledger.Nack(msg.Delivery.DeliveryTag, false, requeue)
+	for _, chunk := range msg.chunks {
+		if err := chunk.Nack(false, requeue); err != nil {
+			return err
+		}
+	}
+
+	if err := msg.Delivery.Acknowledger.Nack(msg.Delivery.DeliveryTag, false, requeue); err != nil {
+		return err
+	}
+
+	msg.settle()
+	return nil
 }
 
 // Reject allows for you to reject on the original channel it was received.
@@ -91,7 +188,18 @@ func (msg *ReceivedMessage) Reject(requeue bool) error {
 		return errors.New("can't reject, internal channel is nil")
 	}
 
-	return msg.Delivery.Acknowledger.Reject(msg.Delivery.DeliveryTag, requeue)
+	for _, chunk := range msg.chunks {
+		if err := chunk.Reject(requeue); err != nil {
+			return err
+		}
+	}
+
+	if err := msg.Delivery.Acknowledger.Reject(msg.Delivery.DeliveryTag, requeue); err != nil {
+		return err
+	}
+
+	msg.settle()
+	return nil
 }
 
 // ErrorMessage allow for you to replay a message that was returned.
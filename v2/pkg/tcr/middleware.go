@@ -0,0 +1,162 @@
+package tcr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrHandlerPanicked is returned by the Recovery middleware when the handler panicked.
+	ErrHandlerPanicked = errors.New("consumer handler panicked")
+
+	// ErrHandlerTimeout is returned by the Timeout middleware when the handler ran past its deadline.
+	ErrHandlerTimeout = errors.New("consumer handler timed out")
+)
+
+// Handler processes a ReceivedMessage. A returned error is sent to the Consumer's Errors, dropped when it's full.
+type Handler func(msg *ReceivedMessage) error
+
+// Middleware wraps a Handler with cross-cutting behaviour (ex. logging, metrics, decoding), calling next to carry on.
+type Middleware func(next Handler) Handler
+
+// Chain composes the middlewares into one, the first being the outermost.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next Handler) Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
+
+// UseMiddleware adds middlewares wrapping every message handed out by the Consumer, the first being the outermost.
+// They run on the consume loop before the action, the ReceivedMessages channel or the batch a message joins.
+// Middlewares added to the RabbitService wrap these. Set them before starting to consume.
+func (con *Consumer) UseMiddleware(middlewares ...Middleware) {
+	con.conLock.Lock()
+	defer con.conLock.Unlock()
+
+	con.middlewares = append(con.middlewares, middlewares...)
+}
+
+// useOuterMiddleware adds middlewares wrapping the ones already added.
+func (con *Consumer) useOuterMiddleware(middlewares ...Middleware) {
+	con.conLock.Lock()
+	defer con.conLock.Unlock()
+
+	con.middlewares = append(append([]Middleware{}, middlewares...), con.middlewares...)
+}
+
+// wrapAction composes the middlewares around the action, handing messages to ReceivedMessages for a nil action.
+// Errors returned by the middlewares are sent to Errors without blocking the consume loop. The lock must be held.
+func (con *Consumer) wrapAction(action func(*ReceivedMessage)) func(*ReceivedMessage) {
+
+	if len(con.middlewares) == 0 {
+		return action
+	}
+
+	handler := Chain(con.middlewares...)(func(msg *ReceivedMessage) error {
+		if action != nil {
+			action(msg)
+		} else {
+			con.receivedMessages <- msg
+		}
+		return nil
+	})
+
+	return func(msg *ReceivedMessage) {
+		if err := handler(msg); err != nil {
+			con.sendError(err)
+		}
+	}
+}
+
+// Recovery is middleware recovering a panicking handler. The message, when ackable and not yet settled, is nacked
+// with requeue (or dead-lettered when configured without). Returns an error wrapping ErrHandlerPanicked.
+func Recovery(requeue bool) Middleware {
+	return func(next Handler) Handler {
+		return func(msg *ReceivedMessage) (err error) {
+
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					err = fmt.Errorf("%w: message %s: %v", ErrHandlerPanicked, msg.MessageID, recovered)
+					if msg.IsAckable && !msg.Settled() {
+						if nackErr := msg.Nack(requeue); nackErr != nil {
+							err = fmt.Errorf("%v, failed to nack: %w", err, nackErr)
+						}
+					}
+				}
+			}()
+
+			return next(msg)
+		}
+	}
+}
+
+// Timeout is middleware giving the handler a deadline through the message's Context. Handlers must watch the Context
+// to stop in time. A message still not settled once the handler returns past the deadline is nacked with requeue
+// (or dead-lettered when configured without) and an error wrapping ErrHandlerTimeout is returned.
+func Timeout(timeout time.Duration, requeue bool) Middleware {
+	return func(next Handler) Handler {
+		return func(msg *ReceivedMessage) error {
+
+			parent := msg.Context()
+			ctx, cancel := context.WithTimeout(parent, timeout)
+			defer cancel()
+
+			msg.ctx = ctx
+			err := next(msg)
+			msg.ctx = parent
+
+			if ctx.Err() != context.DeadlineExceeded {
+				return err
+			}
+
+			timeoutErr := fmt.Errorf("%w: message %s after %s", ErrHandlerTimeout, msg.MessageID, timeout)
+			if msg.IsAckable && !msg.Settled() {
+				if nackErr := msg.Nack(requeue); nackErr != nil {
+					return fmt.Errorf("%v, failed to nack: %w", timeoutErr, nackErr)
+				}
+			}
+
+			return timeoutErr
+		}
+	}
+}
+
+// DecodePayload is middleware decrypting and decompressing the body of messages published with CreatePayload,
+// in place. A body failing to decode is rejected without requeue (dead-lettered when configured) without calling next.
+func DecodePayload(compression *CompressionConfig, encryption *EncryptionConfig) Middleware {
+	return func(next Handler) Handler {
+		return func(msg *ReceivedMessage) error {
+
+			buffer := bytes.NewBuffer(msg.Body)
+			if err := ReadPayload(buffer, compression, encryption); err != nil {
+				err = fmt.Errorf("failed to decode the payload of message %s: %w", msg.MessageID, err)
+				if msg.IsAckable {
+					if rejectErr := msg.Reject(false); rejectErr != nil {
+						return fmt.Errorf("%v, failed to reject: %w", err, rejectErr)
+					}
+				}
+				return err
+			}
+
+			msg.Body = buffer.Bytes()
+			return next(msg)
+		}
+	}
+}
+
+// UseConsumerMiddleware adds middlewares wrapping every message of every Consumer of the RabbitService, outside of
+// the middlewares added to each Consumer. Set them before starting to consume.
+func (rs *RabbitService) UseConsumerMiddleware(middlewares ...Middleware) {
+	rs.serviceLock.Lock()
+	defer rs.serviceLock.Unlock()
+
+	for _, consumer := range rs.consumers {
+		consumer.useOuterMiddleware(middlewares...)
+	}
+}
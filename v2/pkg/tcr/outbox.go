@@ -0,0 +1,375 @@
+package tcr
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultOutboxTableName      = "tcr_outbox"
+	defaultOutboxPollInterval   = time.Duration(1000) * time.Millisecond
+	defaultOutboxBatchSize      = 100
+	defaultOutboxPublishTimeout = time.Duration(5000) * time.Millisecond
+)
+
+// OutboxStore holds letters written alongside application data, so they are only published once the
+// transaction that wrote them has committed. The OutboxRelay reads unsent letters and marks them sent.
+type OutboxStore interface {
+	// Unsent returns up to limit letters that haven't been marked sent, oldest first.
+	Unsent(ctx context.Context, limit int) ([]*Letter, error)
+
+	// MarkSent records the letter as published so it's never relayed again.
+	MarkSent(ctx context.Context, letterID uuid.UUID) error
+}
+
+// SQLExecer is the part of *sql.DB, *sql.Tx and *sql.Conn needed to insert letters into an outbox table.
+type SQLExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// SQLOutboxStore is an OutboxStore backed by a database/sql table.
+type SQLOutboxStore struct {
+	db          *sql.DB
+	table       string
+	placeholder func(position int) string
+}
+
+// NewSQLOutboxStore creates an OutboxStore using the table (and placeholder style) from the OutboxConfig.
+func NewSQLOutboxStore(db *sql.DB, config *OutboxConfig) (*SQLOutboxStore, error) {
+
+	store := &SQLOutboxStore{
+		db:          db,
+		table:       defaultOutboxTableName,
+		placeholder: func(int) string { return "?" },
+	}
+
+	if config == nil {
+		return store, nil
+	}
+
+	if config.TableName != "" {
+		if !validOutboxTableName(config.TableName) {
+			return nil, fmt.Errorf("invalid outbox table name %q", config.TableName)
+		}
+		store.table = config.TableName
+	}
+
+	switch config.PlaceholderStyle {
+	case "", "?":
+	case "$":
+		store.placeholder = func(position int) string { return fmt.Sprintf("$%d", position) }
+	default:
+		return nil, fmt.Errorf("unsupported outbox placeholder style %q", config.PlaceholderStyle)
+	}
+
+	return store, nil
+}
+
+// CreateTable creates the outbox table if it doesn't exist yet.
+func (store *SQLOutboxStore) CreateTable(ctx context.Context) error {
+
+	_, err := store.db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s ("+
+			"letter_id VARCHAR(36) NOT NULL PRIMARY KEY, "+
+			"letter TEXT NOT NULL, "+
+			"created_at TIMESTAMP NOT NULL, "+
+			"sent_at TIMESTAMP NULL)",
+		store.table))
+
+	return err
+}
+
+// Insert writes the letter to the outbox. Pass the *sql.Tx of your own transaction so the letter is only
+// visible to the OutboxRelay once your changes commit, and discarded along with them on rollback.
+func (store *SQLOutboxStore) Insert(ctx context.Context, execer SQLExecer, letter *Letter) error {
+
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+
+	_, err = execer.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (letter_id, letter, created_at) VALUES (%s, %s, %s)",
+		store.table, store.placeholder(1), store.placeholder(2), store.placeholder(3)),
+		letter.LetterID.String(), string(data), time.Now().UTC())
+
+	return err
+}
+
+// Unsent returns up to limit letters that haven't been marked sent, oldest first.
+func (store *SQLOutboxStore) Unsent(ctx context.Context, limit int) ([]*Letter, error) {
+
+	rows, err := store.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT letter FROM %s WHERE sent_at IS NULL ORDER BY created_at, letter_id LIMIT %d",
+		store.table, limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	letters := make([]*Letter, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		letter := &Letter{}
+		if err := json.Unmarshal([]byte(data), letter); err != nil {
+			return nil, err
+		}
+
+		letters = append(letters, letter)
+	}
+
+	return letters, rows.Err()
+}
+
+// MarkSent records the letter as published so it's never relayed again.
+func (store *SQLOutboxStore) MarkSent(ctx context.Context, letterID uuid.UUID) error {
+
+	_, err := store.db.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %s SET sent_at = %s WHERE letter_id = %s",
+		store.table, store.placeholder(1), store.placeholder(2)),
+		time.Now().UTC(), letterID.String())
+
+	return err
+}
+
+// PurgeSent deletes letters that were marked sent before the given time.
+func (store *SQLOutboxStore) PurgeSent(ctx context.Context, before time.Time) (int64, error) {
+
+	result, err := store.db.ExecContext(ctx, fmt.Sprintf(
+		"DELETE FROM %s WHERE sent_at IS NOT NULL AND sent_at < %s",
+		store.table, store.placeholder(1)),
+		before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// FileOutboxStore is an OutboxStore kept in a local Spool, for services without a database
+// (or tests). Writes are fsync'd, but they aren't part of any database transaction.
+type FileOutboxStore struct {
+	spool *Spool
+}
+
+// NewFileOutboxStore opens (or creates) a FileOutboxStore in the directory, keeping every unsent letter.
+func NewFileOutboxStore(directory string) (*FileOutboxStore, error) {
+
+	spool, err := NewSpool(&SpoolConfig{
+		Enabled:    true,
+		Directory:  directory,
+		SyncWrites: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileOutboxStore{spool: spool}, nil
+}
+
+// Insert durably writes the letter to the outbox.
+func (store *FileOutboxStore) Insert(letter *Letter) error {
+	return store.spool.Append(letter)
+}
+
+// Unsent returns up to limit letters that haven't been marked sent, oldest first.
+func (store *FileOutboxStore) Unsent(ctx context.Context, limit int) ([]*Letter, error) {
+	return store.spool.Peek(limit), nil
+}
+
+// MarkSent records the letter as published so it's never relayed again.
+func (store *FileOutboxStore) MarkSent(ctx context.Context, letterID uuid.UUID) error {
+	return store.spool.Ack(letterID)
+}
+
+// Close closes the underlying Spool.
+func (store *FileOutboxStore) Close() error {
+	return store.spool.Close()
+}
+
+// OutboxRelay publishes the unsent letters of an OutboxStore with confirmation and marks them sent.
+// Delivery is at least once: a letter confirmed by the server but not yet marked sent (ex. crash) is published again.
+type OutboxRelay struct {
+	Publisher      *Publisher
+	store          OutboxStore
+	pollInterval   time.Duration
+	batchSize      int
+	publishTimeout time.Duration
+	wake           chan struct{}
+	errors         chan error
+	stop           chan struct{}
+	done           chan struct{}
+	started        bool
+	relayLock      *sync.Mutex
+}
+
+// NewOutboxRelay creates an OutboxRelay publishing from the store with the publisher.
+func NewOutboxRelay(publisher *Publisher, store OutboxStore, config *OutboxConfig) *OutboxRelay {
+
+	relay := &OutboxRelay{
+		Publisher:      publisher,
+		store:          store,
+		pollInterval:   defaultOutboxPollInterval,
+		batchSize:      defaultOutboxBatchSize,
+		publishTimeout: defaultOutboxPublishTimeout,
+		wake:           make(chan struct{}, 1),
+		errors:         make(chan error, 1000),
+		relayLock:      &sync.Mutex{},
+	}
+
+	if config != nil {
+		if config.PollInterval > 0 {
+			relay.pollInterval = time.Duration(config.PollInterval) * time.Millisecond
+		}
+		if config.BatchSize > 0 {
+			relay.batchSize = config.BatchSize
+		}
+		if config.PublishTimeout > 0 {
+			relay.publishTimeout = time.Duration(config.PublishTimeout) * time.Millisecond
+		}
+	}
+
+	return relay
+}
+
+// Start begins relaying unsent letters in the background, every PollInterval or when notified.
+func (relay *OutboxRelay) Start() {
+	relay.relayLock.Lock()
+	defer relay.relayLock.Unlock()
+
+	if relay.started {
+		return
+	}
+
+	relay.started = true
+	relay.stop = make(chan struct{})
+	relay.done = make(chan struct{})
+
+	go relay.relayLoop(relay.stop, relay.done)
+}
+
+// Stop stops relaying and waits for the letter being published to finish.
+func (relay *OutboxRelay) Stop() {
+	relay.relayLock.Lock()
+	defer relay.relayLock.Unlock()
+
+	if !relay.started {
+		return
+	}
+
+	close(relay.stop)
+	<-relay.done
+	relay.started = false
+}
+
+// Notify wakes the relay up ahead of the next poll, ex. right after committing a transaction that inserted letters.
+func (relay *OutboxRelay) Notify() {
+	select {
+	case relay.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Errors yields the errors from reading the store, publishing and marking letters sent.
+func (relay *OutboxRelay) Errors() <-chan error {
+	return relay.errors
+}
+
+// Relay publishes a single batch of unsent letters, in order, and returns how many were marked sent.
+// The batch stops at the first failure so letters aren't published out of order; they're retried on the next call.
+func (relay *OutboxRelay) Relay(ctx context.Context) (int, error) {
+
+	letters, err := relay.store.Unsent(ctx, relay.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, letter := range letters {
+		if err := relay.publish(ctx, letter); err != nil {
+			return i, err
+		}
+
+		if err := relay.store.MarkSent(ctx, letter.LetterID); err != nil {
+			return i, err
+		}
+	}
+
+	return len(letters), nil
+}
+
+func (relay *OutboxRelay) publish(ctx context.Context, letter *Letter) error {
+
+	ctx, cancel := context.WithTimeout(ctx, relay.publishTimeout)
+	defer cancel()
+
+	return relay.Publisher.PublishWithConfirmationContextError(ctx, letter)
+}
+
+func (relay *OutboxRelay) relayLoop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		count, err := relay.Relay(ctx)
+		if err != nil && ctx.Err() == nil {
+			relay.sendError(err)
+		}
+
+		// A full batch means there are likely more letters waiting.
+		if err == nil && count == relay.batchSize {
+			select {
+			case <-stop:
+				return
+			default:
+				continue
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-relay.wake:
+		case <-time.After(relay.pollInterval):
+		}
+	}
+}
+
+func (relay *OutboxRelay) sendError(err error) {
+	select {
+	case relay.errors <- err:
+	default:
+	}
+}
+
+// validOutboxTableName only allows letters, digits, underscores and a schema separator,
+// the table name is formatted into the queries since it can't be bound as a parameter.
+func validOutboxTableName(table string) bool {
+
+	if table == "" {
+		return false
+	}
+
+	return strings.IndexFunc(table, func(r rune) bool {
+		return !(r == '_' || r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	}) == -1
+}
@@ -0,0 +1,142 @@
+package tcr
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const defaultHealthCheckInterval = time.Duration(5000) * time.Millisecond
+
+// HealthCheck reports the health of a downstream dependency (ex. a database), nil when healthy.
+type HealthCheck func(ctx context.Context) error
+
+// Pause stops handing out deliveries by canceling the subscription (basic.cancel) while keeping the Consumer running.
+// Deliveries already prefetched are still handed out and can be settled as usual, the channel they were received on
+// stays reserved to the Consumer while paused. Resume subscribes again on the same channel.
+func (con *Consumer) Pause() {
+	con.setPaused(func() { con.manualPause = true })
+}
+
+// Resume subscribes again after Pause. A Consumer also paused by a failing PauseWhileUnhealthy check stays paused.
+func (con *Consumer) Resume() {
+	con.setPaused(func() { con.manualPause = false })
+}
+
+// Paused returns true while the Consumer is paused, manually or by a failing health check.
+func (con *Consumer) Paused() bool {
+	con.conLock.Lock()
+	defer con.conLock.Unlock()
+
+	return con.manualPause || con.healthPause
+}
+
+// PauseWhileUnhealthy runs the check every interval, pausing the Consumer while it fails and resuming once it passes.
+// The error that paused the Consumer is sent to Errors. Call the returned func to stop checking, which lifts the pause.
+func (con *Consumer) PauseWhileUnhealthy(check HealthCheck, interval time.Duration) func() {
+
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+
+	stop := make(chan struct{})
+	go con.checkHealth(check, interval, stop)
+
+	once := &sync.Once{}
+	return func() {
+		once.Do(func() {
+			close(stop)
+			con.setPaused(func() { con.healthPause = false })
+		})
+	}
+}
+
+func (con *Consumer) checkHealth(check HealthCheck, interval time.Duration, stop <-chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := check(ctx)
+		cancel()
+
+		select {
+		case <-stop:
+			return // don't pause after being stopped
+		default:
+		}
+
+		con.conLock.Lock()
+		pausing := err != nil && !con.healthPause
+		con.conLock.Unlock()
+
+		if pausing {
+			con.sendError(fmt.Errorf("consumer %s paused by a failing health check: %w", con.ConsumerName, err))
+		}
+
+		con.setPaused(func() { con.healthPause = err != nil })
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// setPaused changes the pause state and wakes the consume loop when it changed.
+func (con *Consumer) setPaused(change func()) {
+	con.conLock.Lock()
+	before := con.manualPause || con.healthPause
+	change()
+	after := con.manualPause || con.healthPause
+	con.conLock.Unlock()
+
+	if before != after {
+		select {
+		case con.pauseSignal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// waitWhilePaused blocks while the Consumer is paused, returns true when it's stopped meanwhile.
+func (con *Consumer) waitWhilePaused() bool {
+
+	for con.Paused() {
+		select {
+		case stop := <-con.consumeStop:
+			if stop {
+				return true
+			}
+		case <-con.pauseSignal:
+		}
+	}
+
+	return false
+}
+
+// cancelSubscription cancels the subscription and hands out the deliveries already received, keeping the channel
+// to subscribe on again so they can still be settled. Returns false when the cancel failed and the channel was returned.
+func (con *Consumer) cancelSubscription(deliveryChan <-chan amqp.Delivery, chanHost *ChannelHost, action func(*ReceivedMessage)) bool {
+
+	if err := chanHost.Channel.Cancel(con.consumerTag, false); err != nil {
+		con.ConnectionPool.ReturnChannel(chanHost, true)
+		con.resetChunks()
+		con.resetBatch()
+		con.forgetInFlight()
+		return false
+	}
+
+	// The delivery channel closes once the server confirmed the cancel.
+	for delivery := range deliveryChan {
+		con.handleDelivery(delivery, action)
+	}
+
+	con.flushBatch()
+	return true
+}
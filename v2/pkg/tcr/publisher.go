@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/streadway/amqp"
 )
 
@@ -13,10 +15,28 @@ import (
 type Publisher struct {
 	Config                 *RabbitSeasoning
 	ConnectionPool         *ConnectionPool
-	letters                chan *Letter
-	autoStop               chan bool
+	lanes                  []*publishLane
+	autoStop               chan struct{} // closed to stop the auto-publishing run it was made for
 	publishReceipts        chan *PublishReceipt
+	droppedReceipts        uint64
+	spool                  *Spool
+	spoolPublishing        int32 // 1 while a spooled letter is in flight
+	rateLimiter            *RateLimiter
+	claimCheck             *ClaimCheck
+	chunkSize              int
+	asyncLetters           chan *asyncPublish
+	asyncStop              chan struct{}
+	asyncStopOnce          *sync.Once
+	asyncDone              chan struct{}
+	asyncDrain             chan *publisherDrain
+	asyncStarted           bool
 	autoStarted            bool
+	autoDrain              chan *publisherDrain
+	autoDone               chan struct{}
+	intakeStopped          bool
+	inflight               map[uuid.UUID]*Letter
+	undelivered            []*Letter
+	draining               bool
 	autoPublishGroup       *sync.WaitGroup
 	sleepOnIdleInterval    time.Duration
 	sleepOnErrorInterval   time.Duration
@@ -25,6 +45,12 @@ type Publisher struct {
 	pubRWLock              *sync.RWMutex
 }
 
+// publisherDrain asks a publishing loop to deliver what it has before stopping, or until the context is done.
+type publisherDrain struct {
+	ctx         context.Context
+	undelivered chan []*Letter
+}
+
 // NewPublisherFromConfig creates and configures a new Publisher.
 func NewPublisherFromConfig(
 	config *RabbitSeasoning,
@@ -34,13 +60,22 @@ func NewPublisherFromConfig(
 		config.PublisherConfig.MaxRetryCount = 5
 	}
 
+	var rateLimiter *RateLimiter
+	if config.PublisherConfig.RateLimitConfig != nil {
+		rateLimiter = NewRateLimiter(config.PublisherConfig.RateLimitConfig)
+	}
+
 	return &Publisher{
 		Config:                 config,
+		rateLimiter:            rateLimiter,
 		ConnectionPool:         cp,
-		letters:                make(chan *Letter, 1000),
-		autoStop:               make(chan bool, 1),
+		lanes:                  newPublishLanes(config.PublisherConfig),
 		autoPublishGroup:       &sync.WaitGroup{},
 		publishReceipts:        make(chan *PublishReceipt, 1000),
+		asyncLetters:           make(chan *asyncPublish, 1000),
+		asyncDrain:             make(chan *publisherDrain, 1),
+		autoDrain:              make(chan *publisherDrain, 1),
+		inflight:               make(map[uuid.UUID]*Letter),
 		sleepOnIdleInterval:    time.Duration(config.PublisherConfig.SleepOnIdleInterval) * time.Millisecond,
 		sleepOnErrorInterval:   time.Duration(config.PublisherConfig.SleepOnErrorInterval) * time.Millisecond,
 		publishTimeOutDuration: time.Duration(config.PublisherConfig.PublishTimeOutInterval) * time.Millisecond,
@@ -59,10 +94,13 @@ func NewPublisher(
 
 	return &Publisher{
 		ConnectionPool:         cp,
-		letters:                make(chan *Letter, 1000),
-		autoStop:               make(chan bool, 1),
+		lanes:                  newPublishLanes(nil),
 		autoPublishGroup:       &sync.WaitGroup{},
 		publishReceipts:        make(chan *PublishReceipt, 1000),
+		asyncLetters:           make(chan *asyncPublish, 1000),
+		asyncDrain:             make(chan *publisherDrain, 1),
+		autoDrain:              make(chan *publisherDrain, 1),
+		inflight:               make(map[uuid.UUID]*Letter),
 		sleepOnIdleInterval:    sleepOnIdleInterval,
 		sleepOnErrorInterval:   sleepOnErrorInterval,
 		publishTimeOutDuration: publishTimeOutDuration,
@@ -72,70 +110,54 @@ func NewPublisher(
 	}
 }
 
-// Publish sends a single message to the address on the letter using a cached ChannelHost.
+// Publish sends a single message to the address on the letter using a cached non-confirm ChannelHost.
 // Subscribe to PublishReceipts to see success and errors.
 //
 // For proper resilience (at least once delivery guarantee over shaky network) use PublishWithConfirmation
 func (pub *Publisher) Publish(letter *Letter, skipReceipt bool) {
+	_ = pub.PublishWithError(letter, skipReceipt)
+}
 
-	chanHost := pub.ConnectionPool.GetChannelFromPool()
+// PublishWithError sends a single message to the address on the letter using a cached non-confirm ChannelHost.
+//
+// For proper resilience (at least once delivery guarantee over shaky network) use PublishWithConfirmation
+func (pub *Publisher) PublishWithError(letter *Letter, skipReceipt bool) error {
 
-	err := chanHost.Channel.Publish(
-		letter.Envelope.Exchange,
-		letter.Envelope.RoutingKey,
-		letter.Envelope.Mandatory,
-		letter.Envelope.Immediate,
-		amqp.Publishing{
-			ContentType:   letter.Envelope.ContentType,
-			Body:          letter.Body,
-			Headers:       letter.Envelope.Headers,
-			DeliveryMode:  letter.Envelope.DeliveryMode,
-			Priority:      letter.Envelope.Priority,
-			MessageId:     letter.LetterID.String(),
-			CorrelationId: letter.Envelope.CorrelationID,
-			Type:          letter.Envelope.Type,
-			Timestamp:     time.Now().UTC(),
-			AppId:         pub.ConnectionPool.Config.ApplicationName,
-		},
-	)
+	prepared, done, err := pub.prepare(context.Background(), letter, false)
+	if err == nil {
+		err = pub.publishWithError(prepared)
+		done(err)
+	}
 
 	if !skipReceipt {
 		pub.publishReceipt(letter, err)
 	}
 
-	pub.ConnectionPool.ReturnChannel(chanHost, err != nil)
+	return err
 }
 
-// PublishWithError sends a single message to the address on the letter using a cached ChannelHost.
-//
-// For proper resilience (at least once delivery guarantee over shaky network) use PublishWithConfirmation
-func (pub *Publisher) PublishWithError(letter *Letter, skipReceipt bool) error {
+func (pub *Publisher) publishWithError(letter *Letter) error {
+
+	if chunked, err := pub.publishChunked(context.Background(), letter, 0); chunked {
+		return err
+	}
+
+	return pub.publishNonConfirm(letter)
+}
 
-	chanHost := pub.ConnectionPool.GetChannelFromPool()
+// publishNonConfirm publishes the letter as is on a cached non-confirm ChannelHost.
+func (pub *Publisher) publishNonConfirm(letter *Letter) error {
+
+	chanHost := pub.ConnectionPool.GetNonConfirmChannelFromPool()
 
 	err := chanHost.Channel.Publish(
 		letter.Envelope.Exchange,
 		letter.Envelope.RoutingKey,
 		letter.Envelope.Mandatory,
 		letter.Envelope.Immediate,
-		amqp.Publishing{
-			ContentType:   letter.Envelope.ContentType,
-			Body:          letter.Body,
-			Headers:       letter.Envelope.Headers,
-			DeliveryMode:  letter.Envelope.DeliveryMode,
-			Priority:      letter.Envelope.Priority,
-			MessageId:     letter.LetterID.String(),
-			CorrelationId: letter.Envelope.CorrelationID,
-			Type:          letter.Envelope.Type,
-			Timestamp:     time.Now().UTC(),
-			AppId:         pub.ConnectionPool.Config.ApplicationName,
-		},
+		pub.createPublishing(letter),
 	)
 
-	if !skipReceipt {
-		pub.publishReceipt(letter, err)
-	}
-
 	pub.ConnectionPool.ReturnChannel(chanHost, err != nil)
 	return err
 }
@@ -145,6 +167,22 @@ func (pub *Publisher) PublishWithError(letter *Letter, skipReceipt bool) error {
 // For proper resilience (at least once delivery guarantee over shaky network) use PublishWithConfirmation
 func (pub *Publisher) PublishWithTransient(letter *Letter) error {
 
+	prepared, done, err := pub.prepare(context.Background(), letter, false)
+	if err != nil {
+		return err
+	}
+
+	err = pub.publishWithTransient(prepared)
+	done(err)
+	return err
+}
+
+func (pub *Publisher) publishWithTransient(letter *Letter) error {
+
+	if chunked, err := pub.publishChunked(context.Background(), letter, 0); chunked {
+		return err
+	}
+
 	channel := pub.ConnectionPool.GetTransientChannel(false)
 	defer func() {
 		defer func() {
@@ -158,18 +196,7 @@ func (pub *Publisher) PublishWithTransient(letter *Letter) error {
 		letter.Envelope.RoutingKey,
 		letter.Envelope.Mandatory,
 		letter.Envelope.Immediate,
-		amqp.Publishing{
-			ContentType:   letter.Envelope.ContentType,
-			Body:          letter.Body,
-			Headers:       letter.Envelope.Headers,
-			DeliveryMode:  letter.Envelope.DeliveryMode,
-			Priority:      letter.Envelope.Priority,
-			MessageId:     letter.LetterID.String(),
-			CorrelationId: letter.Envelope.CorrelationID,
-			Type:          letter.Envelope.Type,
-			Timestamp:     time.Now().UTC(),
-			AppId:         pub.ConnectionPool.Config.ApplicationName,
-		},
+		pub.createPublishing(letter),
 	)
 }
 
@@ -179,66 +206,7 @@ func (pub *Publisher) PublishWithTransient(letter *Letter) error {
 // A timeout failure drops the letter back in the PublishReceipts.
 // A confirmation failure keeps trying to publish (at least until timeout failure occurs.)
 func (pub *Publisher) PublishWithConfirmation(letter *Letter, timeout time.Duration) {
-
-	if timeout == 0 {
-		timeout = pub.publishTimeOutDuration
-	}
-
-	for {
-		// Has to use an Ackable channel for Publish Confirmations.
-		chanHost := pub.ConnectionPool.GetChannelFromPool()
-		chanHost.FlushConfirms() // Flush all previous publish confirmations
-
-	Publish:
-		timeoutAfter := time.After(timeout) // timeoutAfter resets everytime we try to publish.
-		err := chanHost.Channel.Publish(
-			letter.Envelope.Exchange,
-			letter.Envelope.RoutingKey,
-			letter.Envelope.Mandatory,
-			letter.Envelope.Immediate,
-			amqp.Publishing{
-				ContentType:   letter.Envelope.ContentType,
-				Body:          letter.Body,
-				Headers:       letter.Envelope.Headers,
-				DeliveryMode:  letter.Envelope.DeliveryMode,
-				Priority:      letter.Envelope.Priority,
-				MessageId:     letter.LetterID.String(),
-				CorrelationId: letter.Envelope.CorrelationID,
-				Type:          letter.Envelope.Type,
-				Timestamp:     time.Now().UTC(),
-				AppId:         pub.ConnectionPool.Config.ApplicationName,
-			},
-		)
-		if err != nil {
-			pub.ConnectionPool.ReturnChannel(chanHost, true)
-			continue // Take it again! From the top!
-		}
-
-		// Wait for very next confirmation on this channel, which should be our confirmation.
-		for {
-			select {
-			case <-timeoutAfter:
-				pub.publishReceipt(letter, fmt.Errorf("publish confirmation for LetterID: %s wasn't received in a timely manner - recommend retry/requeue", letter.LetterID.String()))
-				pub.ConnectionPool.ReturnChannel(chanHost, false) // not a channel error
-				return
-
-			case confirmation := <-chanHost.Confirmations:
-
-				if !confirmation.Ack {
-					goto Publish //nack has occurred, republish
-				}
-
-				// Happy Path, publish was received by server and we didn't timeout client side.
-				pub.publishReceipt(letter, nil)
-				pub.ConnectionPool.ReturnChannel(chanHost, false)
-				return
-
-			default:
-
-				time.Sleep(time.Duration(time.Millisecond * 1)) // limits CPU spin up
-			}
-		}
-	}
+	pub.publishReceipt(letter, pub.PublishWithConfirmationError(letter, timeout))
 }
 
 // PublishWithConfirmationError sends a single message to the address on the letter with confirmation capabilities.
@@ -248,10 +216,26 @@ func (pub *Publisher) PublishWithConfirmation(letter *Letter, timeout time.Durat
 // A confirmation failure keeps trying to publish (at least until timeout failure occurs.)
 func (pub *Publisher) PublishWithConfirmationError(letter *Letter, timeout time.Duration) error {
 
+	prepared, done, err := pub.prepare(context.Background(), letter, false)
+	if err != nil {
+		return err
+	}
+
+	err = pub.publishWithConfirmationError(prepared, timeout)
+	done(err)
+	return err
+}
+
+func (pub *Publisher) publishWithConfirmationError(letter *Letter, timeout time.Duration) error {
+
 	if timeout == 0 {
 		timeout = pub.publishTimeOutDuration
 	}
 
+	if chunked, err := pub.publishChunked(context.Background(), letter, timeout); chunked {
+		return err
+	}
+
 	for {
 		// Has to use an Ackable channel for Publish Confirmations.
 		chanHost := pub.ConnectionPool.GetChannelFromPool()
@@ -264,18 +248,7 @@ func (pub *Publisher) PublishWithConfirmationError(letter *Letter, timeout time.
 			letter.Envelope.RoutingKey,
 			letter.Envelope.Mandatory,
 			letter.Envelope.Immediate,
-			amqp.Publishing{
-				ContentType:   letter.Envelope.ContentType,
-				Body:          letter.Body,
-				Headers:       letter.Envelope.Headers,
-				DeliveryMode:  letter.Envelope.DeliveryMode,
-				Priority:      letter.Envelope.Priority,
-				MessageId:     letter.LetterID.String(),
-				CorrelationId: letter.Envelope.CorrelationID,
-				Type:          letter.Envelope.Type,
-				Timestamp:     time.Now().UTC(),
-				AppId:         pub.ConnectionPool.Config.ApplicationName,
-			},
+			pub.createPublishing(letter),
 		)
 		if err != nil {
 			pub.ConnectionPool.ReturnChannel(chanHost, true)
@@ -312,61 +285,7 @@ func (pub *Publisher) PublishWithConfirmationError(letter *Letter, timeout time.
 // A timeout failure drops the letter back in the PublishReceipts.
 // A confirmation failure keeps trying to publish (at least until timeout failure occurs.)
 func (pub *Publisher) PublishWithConfirmationContext(ctx context.Context, letter *Letter) {
-
-	for {
-		// Has to use an Ackable channel for Publish Confirmations.
-		chanHost := pub.ConnectionPool.GetChannelFromPool()
-		chanHost.FlushConfirms() // Flush all previous publish confirmations
-
-	Publish:
-		err := chanHost.Channel.Publish(
-			letter.Envelope.Exchange,
-			letter.Envelope.RoutingKey,
-			letter.Envelope.Mandatory,
-			letter.Envelope.Immediate,
-			amqp.Publishing{
-				ContentType:   letter.Envelope.ContentType,
-				Body:          letter.Body,
-				Headers:       letter.Envelope.Headers,
-				DeliveryMode:  letter.Envelope.DeliveryMode,
-				Priority:      letter.Envelope.Priority,
-				MessageId:     letter.LetterID.String(),
-				CorrelationId: letter.Envelope.CorrelationID,
-				Type:          letter.Envelope.Type,
-				Timestamp:     time.Now().UTC(),
-				AppId:         pub.ConnectionPool.Config.ApplicationName,
-			},
-		)
-		if err != nil {
-			pub.ConnectionPool.ReturnChannel(chanHost, true)
-			continue // Take it again! From the top!
-		}
-
-		// Wait for very next confirmation on this channel, which should be our confirmation.
-		for {
-			select {
-			case <-ctx.Done():
-				pub.publishReceipt(letter, fmt.Errorf("publish confirmation for LetterID: %s wasn't received before context expired - recommend retry/requeue", letter.LetterID.String()))
-				pub.ConnectionPool.ReturnChannel(chanHost, false) // not a channel error
-				return
-
-			case confirmation := <-chanHost.Confirmations:
-
-				if !confirmation.Ack {
-					goto Publish //nack has occurred, republish
-				}
-
-				// Happy Path, publish was received by server and we didn't timeout client side.
-				pub.publishReceipt(letter, nil)
-				pub.ConnectionPool.ReturnChannel(chanHost, false)
-				return
-
-			default:
-
-				time.Sleep(time.Duration(time.Millisecond * 1)) // limits CPU spin up
-			}
-		}
-	}
+	pub.publishReceipt(letter, pub.PublishWithConfirmationContextError(ctx, letter))
 }
 
 // PublishWithConfirmationContextError sends a single message to the address on the letter with confirmation capabilities.
@@ -375,6 +294,22 @@ func (pub *Publisher) PublishWithConfirmationContext(ctx context.Context, letter
 // A confirmation failure keeps trying to publish (at least until timeout failure occurs.)
 func (pub *Publisher) PublishWithConfirmationContextError(ctx context.Context, letter *Letter) error {
 
+	prepared, done, err := pub.prepare(ctx, letter, false)
+	if err != nil {
+		return err
+	}
+
+	err = pub.publishWithConfirmationContextError(ctx, prepared)
+	done(err)
+	return err
+}
+
+func (pub *Publisher) publishWithConfirmationContextError(ctx context.Context, letter *Letter) error {
+
+	if chunked, err := pub.publishChunked(ctx, letter, -1); chunked {
+		return err
+	}
+
 	for {
 		// Has to use an Ackable channel for Publish Confirmations.
 		chanHost := pub.ConnectionPool.GetChannelFromPool()
@@ -386,18 +321,7 @@ func (pub *Publisher) PublishWithConfirmationContextError(ctx context.Context, l
 			letter.Envelope.RoutingKey,
 			letter.Envelope.Mandatory,
 			letter.Envelope.Immediate,
-			amqp.Publishing{
-				ContentType:   letter.Envelope.ContentType,
-				Body:          letter.Body,
-				Headers:       letter.Envelope.Headers,
-				DeliveryMode:  letter.Envelope.DeliveryMode,
-				Priority:      letter.Envelope.Priority,
-				MessageId:     letter.LetterID.String(),
-				CorrelationId: letter.Envelope.CorrelationID,
-				Type:          letter.Envelope.Type,
-				Timestamp:     time.Now().UTC(),
-				AppId:         pub.ConnectionPool.Config.ApplicationName,
-			},
+			pub.createPublishing(letter),
 		)
 		if err != nil {
 			pub.ConnectionPool.ReturnChannel(chanHost, true)
@@ -435,10 +359,25 @@ func (pub *Publisher) PublishWithConfirmationContextError(ctx context.Context, l
 // A confirmation failure keeps trying to publish (at least until timeout failure occurs.)
 func (pub *Publisher) PublishWithConfirmationTransient(letter *Letter, timeout time.Duration) {
 
+	prepared, done, err := pub.prepare(context.Background(), letter, false)
+	if err == nil {
+		err = pub.publishWithConfirmationTransientError(prepared, timeout)
+		done(err)
+	}
+
+	pub.publishReceipt(letter, err)
+}
+
+func (pub *Publisher) publishWithConfirmationTransientError(letter *Letter, timeout time.Duration) error {
+
 	if timeout == 0 {
 		timeout = pub.publishTimeOutDuration
 	}
 
+	if chunked, err := pub.publishChunked(context.Background(), letter, timeout); chunked {
+		return err
+	}
+
 	for {
 		// Has to use an Ackable channel for Publish Confirmations.
 		channel := pub.ConnectionPool.GetTransientChannel(true)
@@ -452,18 +391,7 @@ func (pub *Publisher) PublishWithConfirmationTransient(letter *Letter, timeout t
 			letter.Envelope.RoutingKey,
 			letter.Envelope.Mandatory,
 			letter.Envelope.Immediate,
-			amqp.Publishing{
-				ContentType:   letter.Envelope.ContentType,
-				Body:          letter.Body,
-				Headers:       letter.Envelope.Headers,
-				DeliveryMode:  letter.Envelope.DeliveryMode,
-				Priority:      letter.Envelope.Priority,
-				MessageId:     letter.LetterID.String(),
-				CorrelationId: letter.Envelope.CorrelationID,
-				Type:          letter.Envelope.Type,
-				Timestamp:     time.Now().UTC(),
-				AppId:         pub.ConnectionPool.Config.ApplicationName,
-			},
+			pub.createPublishing(letter),
 		)
 		if err != nil {
 			channel.Close()
@@ -477,9 +405,8 @@ func (pub *Publisher) PublishWithConfirmationTransient(letter *Letter, timeout t
 		for {
 			select {
 			case <-timeoutAfter:
-				pub.publishReceipt(letter, fmt.Errorf("publish confirmation for LetterID: %s wasn't received in a timely manner (%dms) - recommend retry/requeue", letter.LetterID.String(), timeout))
 				channel.Close()
-				return
+				return fmt.Errorf("publish confirmation for LetterID: %s wasn't received in a timely manner (%dms) - recommend retry/requeue", letter.LetterID.String(), timeout)
 
 			case confirmation := <-confirms:
 
@@ -488,9 +415,8 @@ func (pub *Publisher) PublishWithConfirmationTransient(letter *Letter, timeout t
 				}
 
 				// Happy Path, publish was received by server and we didn't timeout client side.
-				pub.publishReceipt(letter, nil)
 				channel.Close()
-				return
+				return nil
 
 			default:
 
@@ -500,39 +426,84 @@ func (pub *Publisher) PublishWithConfirmationTransient(letter *Letter, timeout t
 	}
 }
 
+// createPublishing builds the amqp.Publishing for the letter, honoring every property on its Envelope.
+func (pub *Publisher) createPublishing(letter *Letter) amqp.Publishing {
+
+	publishing := amqp.Publishing{
+		Headers:         letter.Envelope.Headers,
+		ContentType:     letter.Envelope.ContentType,
+		ContentEncoding: letter.Envelope.ContentEncoding,
+		DeliveryMode:    letter.Envelope.DeliveryMode,
+		Priority:        letter.Envelope.Priority,
+		CorrelationId:   letter.Envelope.CorrelationID,
+		ReplyTo:         letter.Envelope.ReplyTo,
+		Expiration:      letter.Envelope.Expiration,
+		MessageId:       letter.Envelope.MessageID,
+		Timestamp:       letter.Envelope.Timestamp,
+		Type:            letter.Envelope.Type,
+		UserId:          letter.Envelope.UserID,
+		AppId:           letter.Envelope.AppID,
+		Body:            letter.Body,
+	}
+
+	if publishing.MessageId == "" {
+		publishing.MessageId = letter.LetterID.String()
+	}
+
+	if publishing.Timestamp.IsZero() {
+		publishing.Timestamp = time.Now().UTC()
+	}
+
+	if publishing.AppId == "" && pub.ConnectionPool != nil {
+		publishing.AppId = pub.ConnectionPool.Config.ApplicationName
+	}
+
+	return publishing
+}
+
 // PublishReceipts yields all the success and failures during all publish events. Highly recommend susbscribing to this.
+// Once 1000 receipts are waiting to be read further ones are dropped and counted by DroppedReceipts.
 func (pub *Publisher) PublishReceipts() <-chan *PublishReceipt {
 	return pub.publishReceipts
 }
 
+// DroppedReceipts returns the count of receipts dropped because PublishReceipts wasn't read.
+func (pub *Publisher) DroppedReceipts() uint64 {
+	return atomic.LoadUint64(&pub.droppedReceipts)
+}
+
 // StartAutoPublishing starts the Publisher's auto-publishing capabilities.
+// Also re-opens intake for QueueLetter(s) and PublishAsync after a Shutdown.
 func (pub *Publisher) StartAutoPublishing() {
 	pub.pubLock.Lock()
 	defer pub.pubLock.Unlock()
 
+	pub.intakeStopped = false
+
 	if !pub.autoStarted {
 		pub.autoStarted = true
-		go pub.startAutoPublishingLoop()
+		pub.autoStop = make(chan struct{})
+		pub.autoDone = make(chan struct{})
+		go pub.startAutoPublishingLoop(pub.autoStop, pub.autoDone)
 	}
 }
 
 // StartAutoPublish starts auto-publishing letters queued up - is locking.
-func (pub *Publisher) startAutoPublishingLoop() {
+func (pub *Publisher) startAutoPublishingLoop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
 
 AutoPublishLoop:
 	for {
 		// Detect if we should stop publishing.
 		select {
-		case stop := <-pub.autoStop:
-			if stop {
-				break AutoPublishLoop
-			}
+		case <-stop:
+			break AutoPublishLoop
 		default:
 			break
 		}
 
 		// Deliver letters queued in the publisher, returns true when we are to stop publishing.
-		if pub.deliverLetters() {
+		if pub.deliverLetters(stop) {
 			break AutoPublishLoop
 		}
 	}
@@ -542,7 +513,7 @@ AutoPublishLoop:
 	pub.pubLock.Unlock()
 }
 
-func (pub *Publisher) deliverLetters() bool {
+func (pub *Publisher) deliverLetters(stop <-chan struct{}) bool {
 
 	// Allow parallel publishing with transient channels.
 	parallelPublishSemaphore := make(chan struct{}, pub.ConnectionPool.Config.MaxCacheChannelCount/2+1)
@@ -553,16 +524,28 @@ func (pub *Publisher) deliverLetters() bool {
 	PublishLoop:
 		for {
 			select {
-			case letter := <-pub.letters:
+			case drain := <-pub.autoDrain:
 
-				parallelPublishSemaphore <- struct{}{}
-				go func(letter *Letter) {
-					pub.PublishWithConfirmation(letter, pub.publishTimeOutDuration)
-					<-parallelPublishSemaphore
-				}(letter)
+				drain.undelivered <- pub.drainLetters(drain.ctx, parallelPublishSemaphore)
+				return true
 
 			default:
 
+				// Letters are taken from the priority lanes by weight.
+				if letter, ok := pub.nextLetter(); ok {
+					parallelPublishSemaphore <- struct{}{}
+					go func(letter *Letter) {
+						pub.publishQueuedLetter(letter)
+						<-parallelPublishSemaphore
+					}(letter)
+					continue
+				}
+
+				// Spooled letters are only handed out once there is capacity to publish them.
+				if pub.deliverSpooledLetters(parallelPublishSemaphore) {
+					continue
+				}
+
 				if pub.sleepOnIdleInterval > 0 {
 					time.Sleep(pub.sleepOnIdleInterval)
 				}
@@ -573,35 +556,318 @@ func (pub *Publisher) deliverLetters() bool {
 
 		// Detect if we should stop publishing.
 		select {
-		case stop := <-pub.autoStop:
-			if stop {
-				close(pub.letters)
-				return true
-			}
+		case <-stop:
+			return true
 		default:
 			break
 		}
 	}
 }
 
+// publishQueued publishes a queued letter with confirmation, always waiting on the RateLimiter
+// since failing fast would only churn the letter through retries.
+func (pub *Publisher) publishQueued(letter *Letter) error {
+
+	prepared, done, err := pub.prepare(context.Background(), letter, true)
+	if err != nil {
+		return err
+	}
+
+	err = pub.publishWithConfirmationError(prepared, pub.publishTimeOutDuration)
+	done(err)
+	return err
+}
+
+// publishQueuedLetter publishes with confirmation while tracking the letter as in-flight, so it can be
+// reported as undelivered when the Publisher is shutdown before it's confirmed.
+func (pub *Publisher) publishQueuedLetter(letter *Letter) {
+
+	pub.pubRWLock.Lock()
+	pub.inflight[letter.LetterID] = letter
+	pub.pubRWLock.Unlock()
+
+	err := pub.publishQueued(letter)
+
+	pub.pubRWLock.Lock()
+	delete(pub.inflight, letter.LetterID)
+	if err != nil && pub.draining {
+		pub.undelivered = append(pub.undelivered, letter)
+	}
+	pub.pubRWLock.Unlock()
+
+	pub.publishReceipt(letter, err)
+}
+
+// drainLetters publishes every buffered (and spooled) letter, then waits for the in-flight publishes to be confirmed.
+// Returns the letters that weren't delivered before the context was done.
+func (pub *Publisher) drainLetters(ctx context.Context, parallelPublishSemaphore chan struct{}) []*Letter {
+
+	pub.pubRWLock.Lock()
+	pub.draining = true
+	pub.pubRWLock.Unlock()
+
+	undelivered := make([]*Letter, 0)
+
+DrainLoop:
+	for {
+		select {
+		case <-ctx.Done():
+			break DrainLoop
+
+		default:
+
+			if letter, ok := pub.nextLetter(); ok {
+				select {
+				case parallelPublishSemaphore <- struct{}{}:
+				case <-ctx.Done():
+					undelivered = append(undelivered, letter)
+					break DrainLoop
+				}
+
+				go func(letter *Letter) {
+					pub.publishQueuedLetter(letter)
+					<-parallelPublishSemaphore
+				}(letter)
+				continue
+			}
+
+			if pub.deliverSpooledLetters(parallelPublishSemaphore) {
+				continue
+			}
+
+			// Nothing left to hand out, wait for the in-flight publishes.
+			if waitForSemaphore(ctx, parallelPublishSemaphore) {
+				break DrainLoop
+			}
+		}
+	}
+
+	undelivered = append(undelivered, pub.takeBufferedLetters()...)
+
+	pub.pubRWLock.Lock()
+	defer pub.pubRWLock.Unlock()
+
+	undelivered = append(undelivered, pub.undelivered...)
+	for _, letter := range pub.inflight {
+		undelivered = append(undelivered, letter)
+	}
+
+	pub.undelivered = nil
+	pub.draining = false
+
+	return undelivered
+}
+
+// waitForSemaphore waits until every slot of the semaphore is free, returns false if the context was done first.
+func waitForSemaphore(ctx context.Context, semaphore chan struct{}) bool {
+
+	acquired := 0
+	defer func() {
+		for ; acquired > 0; acquired-- {
+			<-semaphore
+		}
+	}()
+
+	for acquired < cap(semaphore) {
+		select {
+		case semaphore <- struct{}{}:
+			acquired++
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	return true
+}
+
+// takeBufferedLetters empties the letters buffered for auto-publishing.
+func (pub *Publisher) takeBufferedLetters() []*Letter {
+
+	letters := make([]*Letter, 0)
+	for _, lane := range pub.lanes {
+	LaneLoop:
+		for {
+			select {
+			case letter := <-lane.letters:
+				letters = append(letters, letter)
+			default:
+				break LaneLoop
+			}
+		}
+	}
+
+	return letters
+}
+
+// deliverSpooledLetters publishes the oldest letter waiting in the spool, when publishing capacity allows and no other
+// spooled letter is in flight, and returns true if one was delivered. Spooled letters are published one at a time to keep them in order.
+func (pub *Publisher) deliverSpooledLetters(parallelPublishSemaphore chan struct{}) bool {
+
+	spool := pub.Spool()
+	if spool == nil {
+		return false
+	}
+
+	if !atomic.CompareAndSwapInt32(&pub.spoolPublishing, 0, 1) {
+		return false
+	}
+
+	select {
+	case parallelPublishSemaphore <- struct{}{}:
+	default:
+		atomic.StoreInt32(&pub.spoolPublishing, 0)
+		return false
+	}
+
+	letter, ok := spool.Dequeue()
+	if !ok {
+		<-parallelPublishSemaphore
+		atomic.StoreInt32(&pub.spoolPublishing, 0)
+		return false
+	}
+
+	go func(letter *Letter) {
+		pub.publishSpooledLetter(spool, letter)
+		atomic.StoreInt32(&pub.spoolPublishing, 0)
+		<-parallelPublishSemaphore
+	}(letter)
+
+	return true
+}
+
+// publishSpooledLetter publishes with confirmation and only then removes the letter from the spool.
+// Failures are put back at the front of the spool to be retried after a backoff, a single failure
+// receipt is sent once the letter runs out of attempts and is dropped from the spool.
+func (pub *Publisher) publishSpooledLetter(spool *Spool, letter *Letter) {
+
+	err := pub.publishQueued(letter)
+	if err != nil {
+		if spool.Requeue(letter.LetterID) {
+			return
+		}
+
+		pub.publishReceipt(letter, fmt.Errorf("letter dropped from the spool after exhausting its attempts: %w", err))
+		return
+	}
+
+	// Worst case on a failed ack is the letter being published again after a restart.
+	_ = spool.Ack(letter.LetterID)
+	pub.publishReceipt(letter, nil)
+}
+
+// UseRateLimiter throttles every publish path of the Publisher with the RateLimiter.
+// Set it before publishing, letters being published while it changes aren't throttled consistently.
+func (pub *Publisher) UseRateLimiter(limiter *RateLimiter) {
+	pub.pubLock.Lock()
+	defer pub.pubLock.Unlock()
+
+	pub.rateLimiter = limiter
+}
+
+// RateLimiter returns the RateLimiter used by the Publisher, nil when publishing isn't throttled.
+func (pub *Publisher) RateLimiter() *RateLimiter {
+	pub.pubLock.Lock()
+	defer pub.pubLock.Unlock()
+
+	return pub.rateLimiter
+}
+
+// prepare reserves rate limiting capacity for the letter, then checks in its body when over the ClaimCheck threshold.
+// The done func frees the capacity once the publish is over. When the publish failed it also deletes the checked in
+// body, so it isn't left behind in the BlobStore, failed letters keep their body and are checked in again on retry.
+func (pub *Publisher) prepare(ctx context.Context, letter *Letter, queued bool) (*Letter, func(error), error) {
+
+	pub.pubLock.Lock()
+	claimCheck := pub.claimCheck
+	pub.pubLock.Unlock()
+
+	// Checked in bodies aren't published, only their reference.
+	size := len(letter.Body)
+	if claimCheck != nil && claimCheck.checksIn(letter) {
+		size = 0
+	}
+
+	release, err := pub.rateLimit(ctx, size, queued)
+	if err != nil {
+		return letter, nil, err
+	}
+
+	if claimCheck == nil {
+		return letter, func(error) { release() }, nil
+	}
+
+	checkedIn, err := claimCheck.CheckIn(ctx, letter)
+	if err != nil {
+		release()
+		return letter, nil, err
+	}
+
+	return checkedIn, func(err error) {
+		release()
+		if err != nil && checkedIn != letter {
+			_ = claimCheck.Store.Delete(context.Background(), letter.LetterID.String())
+		}
+	}, nil
+}
+
+// rateLimit reserves capacity to publish size bytes, the release func frees the in-flight slot once confirmed.
+// Queued letters always wait, otherwise the RateLimiter decides between waiting and failing fast.
+func (pub *Publisher) rateLimit(ctx context.Context, size int, queued bool) (func(), error) {
+
+	limiter := pub.RateLimiter()
+	if limiter == nil {
+		return func() {}, nil
+	}
+
+	return limiter.acquire(ctx, size, queued || !limiter.failFast)
+}
+
+// UseSpool makes QueueLetter(s) durably write letters to the Spool instead of the in-memory buffer.
+// Letters are removed from the Spool after the server confirms them, so anything still pending
+// (ex. during a broker outage or after a crash) is replayed in order once the Publisher can publish again.
+// Spooled letters are published one at a time. A failing letter holds back the ones behind it while it's retried
+// with backoff, until it runs out of SpoolConfig MaxAttempts and is dropped with a single failure receipt.
+func (pub *Publisher) UseSpool(spool *Spool) {
+	pub.pubLock.Lock()
+	defer pub.pubLock.Unlock()
+
+	pub.spool = spool
+}
+
+// Spool returns the Spool used by the Publisher, nil when letters are only buffered in memory.
+func (pub *Publisher) Spool() *Spool {
+	pub.pubLock.Lock()
+	defer pub.pubLock.Unlock()
+
+	return pub.spool
+}
+
 // stopAutoPublish stops publishing letters queued up.
 func (pub *Publisher) stopAutoPublish() {
 	pub.pubLock.Lock()
 	defer pub.pubLock.Unlock()
 
+	pub.intakeStopped = true
+
 	if !pub.autoStarted {
 		return
 	}
 
-	go func() { pub.autoStop <- true }() // signal auto publish to stop
+	// Signal auto publish to stop, only this run sees it.
+	select {
+	case <-pub.autoStop:
+	default:
+		close(pub.autoStop)
+	}
 }
 
 // QueueLetters allows you to bulk queue letters that will be consumed by AutoPublish. By default, AutoPublish uses PublishWithConfirmation as the mechanism for publishing.
+// Returns false once the Publisher has been shutdown, until StartAutoPublishing is called again.
 func (pub *Publisher) QueueLetters(letters []*Letter) bool {
 
 	for _, letter := range letters {
 
-		if ok := pub.safeSend(letter); !ok {
+		if ok := pub.safeSend(letter, PriorityNormal); !ok {
 			return false
 		}
 	}
@@ -610,48 +876,125 @@ func (pub *Publisher) QueueLetters(letters []*Letter) bool {
 }
 
 // QueueLetter queues up a letter that will be consumed by AutoPublish. By default, AutoPublish uses PublishWithConfirmation as the mechanism for publishing.
+// With a Spool, the letter is durably written to disk instead and false means the write failed.
 func (pub *Publisher) QueueLetter(letter *Letter) bool {
 
-	return pub.safeSend(letter)
+	return pub.safeSend(letter, PriorityNormal)
+}
+
+// QueueLetterWithPriority queues up a letter in the auto-publisher lane of the priority. Lanes are dequeued by weight,
+// so a flood of low priority letters can't hold up high priority ones. Blocks while the lane is at capacity.
+// With a Spool, letters are published in the order they were spooled regardless of priority.
+func (pub *Publisher) QueueLetterWithPriority(letter *Letter, priority LetterPriority) bool {
+
+	return pub.safeSend(letter, priority)
 }
 
 // safeSend should handle a scenario on publishing to a closed channel.
-func (pub *Publisher) safeSend(letter *Letter) (closed bool) {
+func (pub *Publisher) safeSend(letter *Letter, priority LetterPriority) (closed bool) {
 	defer func() {
 		if recover() != nil {
 			closed = false
 		}
 	}()
 
-	pub.letters <- letter
+	if pub.intakeClosed() {
+		return false
+	}
+
+	if spool := pub.Spool(); spool != nil {
+		return spool.Append(letter) == nil
+	}
+
+	lane := pub.lane(priority)
+	lane.letters <- letter
+	atomic.AddUint64(&lane.enqueued, 1)
 	return true // success
 }
 
-// publishReceipt sends the status to the receipt channel.
+// publishReceipt sends the status to the receipt channel without blocking, counting it as dropped when full.
 func (pub *Publisher) publishReceipt(letter *Letter, err error) {
 
-	go func(*Letter, error) {
-		publishReceipt := &PublishReceipt{
-			LetterID: letter.LetterID,
-			Error:    err,
-		}
+	publishReceipt := &PublishReceipt{
+		LetterID: letter.LetterID,
+		Error:    err,
+	}
 
-		if err == nil {
-			publishReceipt.Success = true
-		} else {
-			publishReceipt.FailedLetter = letter
-		}
+	if err == nil {
+		publishReceipt.Success = true
+	} else {
+		publishReceipt.FailedLetter = letter
+	}
+
+	select {
+	case pub.publishReceipts <- publishReceipt:
+	default:
+		atomic.AddUint64(&pub.droppedReceipts, 1)
+	}
+}
+
+// intakeClosed returns true while the Publisher refuses new letters (after Shutdown).
+func (pub *Publisher) intakeClosed() bool {
+	pub.pubLock.Lock()
+	defer pub.pubLock.Unlock()
 
-		pub.publishReceipts <- publishReceipt
-	}(letter, err)
+	return pub.intakeStopped
 }
 
 // Shutdown cleanly shutdown the publisher and resets it's internal state.
+// Letters still buffered stay queued and are published if StartAutoPublishing is called again, use ShutdownContext to drain them.
 func (pub *Publisher) Shutdown(shutdownPools bool) {
 
 	pub.stopAutoPublish()
+	pub.stopAsyncPublishing()
 
 	if shutdownPools { // in case the ChannelPool is shared between structs, you can prevent it from shutting down
 		pub.ConnectionPool.Shutdown()
 	}
 }
+
+// ShutdownContext gracefully shuts down the publisher without losing letters. QueueLetter(s) and PublishAsync are refused,
+// buffered letters are published and confirmations awaited, until everything is delivered or the context is done.
+// Returns the letters that weren't confirmed in time (some may still be confirmed afterwards) along with an error.
+// Spooled letters are not returned, they stay in the Spool. StartAutoPublishing can be called again afterwards.
+func (pub *Publisher) ShutdownContext(ctx context.Context) ([]*Letter, error) {
+
+	pub.pubLock.Lock()
+	pub.intakeStopped = true
+	autoStarted, autoDone := pub.autoStarted, pub.autoDone
+	pub.pubLock.Unlock()
+
+	var undelivered []*Letter
+	if autoStarted {
+		drain := &publisherDrain{
+			ctx:         ctx,
+			undelivered: make(chan []*Letter, 1),
+		}
+
+		pub.autoDrain <- drain
+
+		select {
+		case undelivered = <-drain.undelivered:
+		case <-autoDone:
+			// Stopped (ex. by Shutdown) before it could drain.
+			select {
+			case <-pub.autoDrain:
+			default:
+			}
+			undelivered = pub.takeBufferedLetters()
+		}
+
+		<-autoDone
+	} else {
+		// Nothing is going to publish what's buffered.
+		undelivered = pub.takeBufferedLetters()
+	}
+
+	undelivered = append(undelivered, pub.drainAsyncPublishing(ctx)...)
+
+	if len(undelivered) > 0 {
+		return undelivered, fmt.Errorf("%d letters were not delivered before the publisher was shutdown", len(undelivered))
+	}
+
+	return undelivered, nil
+}
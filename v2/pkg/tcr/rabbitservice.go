@@ -1,6 +1,7 @@
 package tcr
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -84,6 +85,46 @@ func NewRabbitServiceWithPublisher(
 		return nil, err
 	}
 
+	// Move large bodies into a shared BlobStore when configured.
+	if config.ClaimCheckConfig != nil && config.ClaimCheckConfig.Enabled {
+		claimCheck, err := NewClaimCheckFromConfig(config.ClaimCheckConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		publisher.UseClaimCheck(claimCheck)
+		for _, consumer := range rs.consumers {
+			consumer.UseClaimCheck(claimCheck)
+		}
+	}
+
+	// Split large bodies into chunk messages when configured, each consumer reassembling its own.
+	if config.ChunkingConfig != nil && config.ChunkingConfig.Enabled {
+		chunkSize := config.ChunkingConfig.ChunkSize
+		if chunkSize <= 0 {
+			chunkSize = defaultChunkSize
+		}
+
+		publisher.UseChunking(chunkSize)
+		for _, consumer := range rs.consumers {
+			consumer.UseReassembler(NewReassembler(config.ChunkingConfig))
+		}
+	}
+
+	// Durably spool queued letters to disk when configured.
+	if config.PublisherConfig != nil &&
+		config.PublisherConfig.SpoolConfig != nil &&
+		config.PublisherConfig.SpoolConfig.Enabled &&
+		publisher.Spool() == nil {
+
+		spool, err := NewSpool(config.PublisherConfig.SpoolConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		publisher.UseSpool(spool)
+	}
+
 	// Create a HashKey for Encryption
 	if config.EncryptionConfig.Enabled && len(passphrase) > 0 && len(salt) > 0 {
 		rs.Config.EncryptionConfig.Hashkey = GetHashWithArgon(
@@ -127,6 +168,10 @@ func (rs *RabbitService) createConsumers(consumerConfigs map[string]*ConsumerCon
 	for consumerName, consumerConfig := range consumerConfigs {
 
 		consumer := NewConsumerFromConfig(consumerConfig, rs.ConnectionPool)
+		if err := consumer.UseDedup(consumerConfig.DedupConfig); err != nil {
+			return fmt.Errorf("consumer %s: %w", consumerName, err)
+		}
+
 		hostName, err := os.Hostname()
 
 		if err == nil {
@@ -336,6 +381,22 @@ func (rs *RabbitService) Shutdown(stopConsumers bool) {
 
 	rs.Publisher.Shutdown(false)
 
+	rs.shutdownService(stopConsumers)
+}
+
+// ShutdownContext gracefully stops the service, giving the Publisher until the context is done to deliver
+// the letters already queued, then shuts down the ChannelPool. Returns the letters that weren't delivered.
+func (rs *RabbitService) ShutdownContext(ctx context.Context, stopConsumers bool) ([]*Letter, error) {
+
+	undelivered, err := rs.Publisher.ShutdownContext(ctx)
+
+	rs.shutdownService(stopConsumers)
+
+	return undelivered, err
+}
+
+func (rs *RabbitService) shutdownService(stopConsumers bool) {
+
 	time.Sleep(time.Second)
 	rs.shutdownSignal <- true
 	time.Sleep(time.Second)
@@ -350,6 +411,13 @@ func (rs *RabbitService) Shutdown(stopConsumers bool) {
 	}
 
 	rs.ConnectionPool.Shutdown()
+
+	// Letters still in the spool are replayed the next time it's opened.
+	if spool := rs.Publisher.Spool(); spool != nil {
+		if err := spool.Close(); err != nil {
+			rs.centralErr <- err
+		}
+	}
 }
 
 func (rs *RabbitService) monitorForShutdown() {
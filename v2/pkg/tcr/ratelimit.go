@@ -0,0 +1,237 @@
+package tcr
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned by fail-fast rate limiting when a publish would exceed the limits.
+var ErrRateLimited = errors.New("publish rate limit exceeded")
+
+// RateLimiter throttles publishing with token buckets for messages and bytes per second, and a cap on
+// messages awaiting confirmation. When blocking, publishes wait for capacity, otherwise they fail with ErrRateLimited.
+type RateLimiter struct {
+	messages *tokenBucket
+	bytes    *tokenBucket
+	inFlight chan struct{}
+	failFast bool
+}
+
+// NewRateLimiter creates a RateLimiter from the RateLimitConfig. Zero values are unlimited.
+func NewRateLimiter(config *RateLimitConfig) *RateLimiter {
+
+	limiter := &RateLimiter{
+		failFast: config.FailFast,
+	}
+
+	if config.MessagesPerSecond > 0 {
+		limiter.messages = newTokenBucket(config.MessagesPerSecond, config.MessageBurst)
+	}
+
+	if config.BytesPerSecond > 0 {
+		limiter.bytes = newTokenBucket(config.BytesPerSecond, config.ByteBurst)
+	}
+
+	if config.MaxInFlight > 0 {
+		limiter.inFlight = make(chan struct{}, config.MaxInFlight)
+	}
+
+	return limiter
+}
+
+// Acquire reserves capacity to publish a message of the given size, blocking or failing fast depending on the config.
+// The returned release func must be called once the message is confirmed (or the publish failed).
+func (limiter *RateLimiter) Acquire(ctx context.Context, size int) (func(), error) {
+	return limiter.acquire(ctx, size, !limiter.failFast)
+}
+
+// InFlight returns the count of messages currently holding capacity.
+func (limiter *RateLimiter) InFlight() int {
+	return len(limiter.inFlight)
+}
+
+func (limiter *RateLimiter) acquire(ctx context.Context, size int, block bool) (func(), error) {
+
+	if !block {
+		return limiter.tryAcquire(size)
+	}
+
+	if limiter.inFlight != nil {
+		select {
+		case limiter.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	var wait time.Duration
+	var refunds []func()
+	for _, reservation := range []struct {
+		bucket *tokenBucket
+		tokens float64
+	}{
+		{limiter.messages, 1},
+		{limiter.bytes, float64(size)},
+	} {
+		if reservation.bucket == nil {
+			continue
+		}
+
+		bucket, tokens := reservation.bucket, reservation.tokens
+		if delay := bucket.reserve(tokens); delay > wait {
+			wait = delay
+		}
+		refunds = append(refunds, func() { bucket.refund(tokens) })
+	}
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			for _, refund := range refunds {
+				refund()
+			}
+			limiter.release()
+			return nil, ctx.Err()
+		}
+	}
+
+	return limiter.releaseOnce(), nil
+}
+
+func (limiter *RateLimiter) tryAcquire(size int) (func(), error) {
+
+	if limiter.inFlight != nil {
+		select {
+		case limiter.inFlight <- struct{}{}:
+		default:
+			return nil, ErrRateLimited
+		}
+	}
+
+	if !tryTakeAll(limiter.messages, 1, limiter.bytes, float64(size)) {
+		limiter.release()
+		return nil, ErrRateLimited
+	}
+
+	return limiter.releaseOnce(), nil
+}
+
+func (limiter *RateLimiter) release() {
+	if limiter.inFlight != nil {
+		<-limiter.inFlight
+	}
+}
+
+func (limiter *RateLimiter) releaseOnce() func() {
+	once := &sync.Once{}
+	return func() { once.Do(limiter.release) }
+}
+
+// tokenBucket refills at rate tokens per second up to burst tokens. Reservations may take the bucket
+// negative, the caller then waits for the debt to be refilled.
+type tokenBucket struct {
+	rate       float64
+	burst      float64
+	tokens     float64
+	last       time.Time
+	bucketLock *sync.Mutex
+}
+
+func newTokenBucket(rate float64, burst float64) *tokenBucket {
+
+	if burst <= 0 {
+		burst = rate // one second worth
+	}
+
+	return &tokenBucket{
+		rate:       rate,
+		burst:      burst,
+		tokens:     burst,
+		last:       time.Now(),
+		bucketLock: &sync.Mutex{},
+	}
+}
+
+func (bucket *tokenBucket) refill(now time.Time) {
+
+	bucket.tokens += now.Sub(bucket.last).Seconds() * bucket.rate
+	if bucket.tokens > bucket.burst {
+		bucket.tokens = bucket.burst
+	}
+
+	bucket.last = now
+}
+
+// reserve takes the tokens and returns how long to wait until they are paid for.
+func (bucket *tokenBucket) reserve(tokens float64) time.Duration {
+	bucket.bucketLock.Lock()
+	defer bucket.bucketLock.Unlock()
+
+	bucket.refill(time.Now())
+	bucket.tokens -= tokens
+	if bucket.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-bucket.tokens / bucket.rate * float64(time.Second))
+}
+
+func (bucket *tokenBucket) refund(tokens float64) {
+	bucket.bucketLock.Lock()
+	defer bucket.bucketLock.Unlock()
+
+	bucket.tokens += tokens
+	if bucket.tokens > bucket.burst {
+		bucket.tokens = bucket.burst
+	}
+}
+
+// available returns true when the tokens can be taken right away. Requests larger than the
+// burst only need a full bucket, otherwise they could never be taken.
+func (bucket *tokenBucket) available(tokens float64) bool {
+
+	bucket.refill(time.Now())
+	if tokens > bucket.burst {
+		tokens = bucket.burst
+	}
+
+	return bucket.tokens >= tokens
+}
+
+// tryTakeAll takes the tokens from both (optional) buckets, or none of them.
+func tryTakeAll(messages *tokenBucket, messageTokens float64, bytes *tokenBucket, byteTokens float64) bool {
+
+	if messages != nil {
+		messages.bucketLock.Lock()
+		defer messages.bucketLock.Unlock()
+	}
+
+	if bytes != nil {
+		bytes.bucketLock.Lock()
+		defer bytes.bucketLock.Unlock()
+	}
+
+	if messages != nil && !messages.available(messageTokens) {
+		return false
+	}
+
+	if bytes != nil && !bytes.available(byteTokens) {
+		return false
+	}
+
+	if messages != nil {
+		messages.tokens -= messageTokens
+	}
+
+	if bytes != nil {
+		bytes.tokens -= byteTokens
+	}
+
+	return true
+}
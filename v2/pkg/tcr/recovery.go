@@ -0,0 +1,56 @@
+package tcr
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// ConsumerRecovery is emitted on Recoveries when a Consumer resubscribed after losing its channel.
+type ConsumerRecovery struct {
+	ConsumerName string
+	QueueName    string
+	Attempts     int           // subscription attempts it took
+	Downtime     time.Duration // since the previous subscription was lost
+	Redeclared   bool          // the topology was declared again before resubscribing
+}
+
+// UseTopology sets the topology (exchanges, queues and bindings) the Consumer depends on, declared on the consumer's
+// own channel before every (re)subscription so exclusive and auto-delete queues come back after a failover.
+// Overrides the ConsumerConfig Topology, set it before starting to consume.
+func (con *Consumer) UseTopology(topology *TopologyConfig) {
+	con.conLock.Lock()
+	defer con.conLock.Unlock()
+
+	con.topology = topology
+}
+
+// Recoveries yields a ConsumerRecovery every time the Consumer resubscribes after losing its channel.
+// Recoveries are dropped when nobody is receiving them.
+func (con *Consumer) Recoveries() <-chan *ConsumerRecovery {
+	return con.recoveries
+}
+
+// declareTopology declares the consumer's topology on the channel, returns false when it has none.
+func (con *Consumer) declareTopology(channel *amqp.Channel) (bool, error) {
+
+	if con.topology == nil {
+		return false, nil
+	}
+
+	if err := newChannelTopologer(channel).BuildTopology(con.topology, false); err != nil {
+		err = fmt.Errorf("consumer %s failed to declare its topology: %w", con.ConsumerName, err)
+		con.sendError(err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (con *Consumer) notifyRecovery(recovery *ConsumerRecovery) {
+	select {
+	case con.recoveries <- recovery:
+	default:
+	}
+}
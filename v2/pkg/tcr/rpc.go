@@ -0,0 +1,351 @@
+package tcr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// DirectReplyTo is the RabbitMQ pseudo queue for replies without declaring a reply queue.
+	DirectReplyTo = "amq.rabbitmq.reply-to"
+
+	// RPCErrorHeader holds the error returned by the RPCHandler, the reply has no body.
+	RPCErrorHeader = "x-tcr-rpc-error"
+
+	defaultRPCTimeout = time.Duration(30000) * time.Millisecond
+)
+
+var (
+	// ErrRPCClientClosed is returned by calls on a closed RPCClient.
+	ErrRPCClientClosed = errors.New("rpc client is closed")
+
+	// ErrRPCReplyLost is returned when the reply channel closed before the reply arrived.
+	ErrRPCReplyLost = errors.New("rpc reply channel closed before the reply arrived")
+
+	// ErrRPCRemote wraps the error returned by the RPCHandler of the server.
+	ErrRPCRemote = errors.New("rpc server returned an error")
+)
+
+// RPCClient publishes requests and awaits their replies, correlated by CorrelationID, on a reply queue shared by every call.
+// Uses RabbitMQ direct reply-to by default, or an exclusive server named queue with RPCConfig.PrivateReplyQueue.
+type RPCClient struct {
+	Publisher    *Publisher
+	privateQueue bool
+	timeout      time.Duration
+	channel      *amqp.Channel
+	replyTo      string
+	pending      map[string]*replyWaiter
+	closed       bool
+	rpcLock      *sync.Mutex
+}
+
+// replyWaiter receives the replies of one CorrelationID, or the return of its unroutable mandatory request.
+// Lost is closed when the reply channel closes.
+type replyWaiter struct {
+	replies  chan *ReceivedMessage
+	returned chan amqp.Return
+	lost     chan struct{}
+}
+
+// NewRPCClient creates an RPCClient publishing with the Publisher. The reply queue is set up on the first call.
+func NewRPCClient(publisher *Publisher, config *RPCConfig) *RPCClient {
+
+	client := &RPCClient{
+		Publisher: publisher,
+		timeout:   defaultRPCTimeout,
+		pending:   make(map[string]*replyWaiter),
+		rpcLock:   &sync.Mutex{},
+	}
+
+	if config != nil {
+		client.privateQueue = config.PrivateReplyQueue
+		if config.Timeout > 0 {
+			client.timeout = time.Duration(config.Timeout) * time.Millisecond
+		}
+	}
+
+	return client
+}
+
+// Call publishes the letter as a request and returns the reply, waiting until the context is done or the RPCConfig Timeout expires.
+// The CorrelationID of the letter is used when set, otherwise a new one is generated. Errors returned by the server's
+// RPCHandler are wrapped in ErrRPCRemote, along with the reply. A Mandatory request the server couldn't route fails
+// right away with an error wrapping ErrPublishReturned.
+func (client *RPCClient) Call(ctx context.Context, letter *Letter) (*ReceivedMessage, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, client.timeout)
+	defer cancel()
+
+	correlationID, waiter, err := client.request(ctx, letter, 1)
+	if err != nil {
+		return nil, err
+	}
+	defer client.forget(correlationID)
+
+	select {
+	case reply := <-waiter.replies:
+		return reply, RPCReplyError(reply)
+	case returned := <-waiter.returned:
+		return nil, requestReturnedError(correlationID, returned)
+	case <-waiter.lost:
+		return nil, ErrRPCReplyLost
+	case <-ctx.Done():
+		return nil, fmt.Errorf("rpc reply for CorrelationID %s wasn't received in time: %w", correlationID, ctx.Err())
+	}
+}
+
+// Close stops receiving replies, failing the calls still waiting on one.
+func (client *RPCClient) Close() {
+	client.rpcLock.Lock()
+	client.closed = true
+	channel := client.channel
+	client.rpcLock.Unlock()
+
+	if channel != nil {
+		channel.Close()
+	}
+}
+
+// request registers a waiter for up to capacity replies and publishes the letter on the reply channel,
+// as direct reply-to requires. Returns the CorrelationID of the request.
+func (client *RPCClient) request(ctx context.Context, letter *Letter, capacity int) (string, *replyWaiter, error) {
+
+	envelope := *letter.Envelope
+	if envelope.CorrelationID == "" {
+		envelope.CorrelationID = uuid.New().String()
+	}
+
+	request, done, err := client.Publisher.prepare(ctx, &Letter{
+		LetterID:   letter.LetterID,
+		RetryCount: letter.RetryCount,
+		Body:       letter.Body,
+		Envelope:   &envelope,
+	}, false)
+	if err != nil {
+		return "", nil, err
+	}
+
+	waiter, err := client.publishRequest(request, capacity)
+	done(err)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return envelope.CorrelationID, waiter, nil
+}
+
+// publishRequest registers the waiter of the prepared request and publishes it on the reply channel.
+func (client *RPCClient) publishRequest(request *Letter, capacity int) (*replyWaiter, error) {
+	client.rpcLock.Lock()
+	defer client.rpcLock.Unlock()
+
+	if client.closed {
+		return nil, ErrRPCClientClosed
+	}
+
+	if client.channel == nil {
+		if err := client.connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	correlationID := request.Envelope.CorrelationID
+	waiter := &replyWaiter{
+		replies:  make(chan *ReceivedMessage, capacity),
+		returned: make(chan amqp.Return, 1),
+		lost:     make(chan struct{}),
+	}
+	client.pending[correlationID] = waiter
+
+	request.Envelope.ReplyTo = client.replyTo
+	err := client.channel.Publish(
+		request.Envelope.Exchange,
+		request.Envelope.RoutingKey,
+		request.Envelope.Mandatory,
+		request.Envelope.Immediate,
+		client.Publisher.createPublishing(request),
+	)
+	if err != nil {
+		delete(client.pending, correlationID)
+		return nil, err
+	}
+
+	return waiter, nil
+}
+
+func (client *RPCClient) forget(correlationID string) {
+	client.rpcLock.Lock()
+	defer client.rpcLock.Unlock()
+
+	delete(client.pending, correlationID)
+}
+
+// connect opens the reply channel and starts consuming replies, the lock must be held.
+func (client *RPCClient) connect() error {
+
+	channel := client.Publisher.ConnectionPool.GetTransientChannel(false)
+	returns := channel.NotifyReturn(make(chan amqp.Return, 100))
+
+	replyTo := DirectReplyTo
+	if client.privateQueue {
+		queue, err := channel.QueueDeclare("", false, true, true, false, nil)
+		if err != nil {
+			channel.Close()
+			return err
+		}
+		replyTo = queue.Name
+	}
+
+	// Direct reply-to must be consumed with auto acknowledgement.
+	deliveries, err := channel.Consume(replyTo, "", true, true, false, false, nil)
+	if err != nil {
+		channel.Close()
+		return err
+	}
+
+	client.channel = channel
+	client.replyTo = replyTo
+
+	go client.receiveReplies(channel, deliveries)
+	go client.receiveReturns(returns)
+
+	return nil
+}
+
+// receiveReplies hands out replies until the channel closes, then fails every pending call.
+func (client *RPCClient) receiveReplies(channel *amqp.Channel, deliveries <-chan amqp.Delivery) {
+
+	for delivery := range deliveries {
+		client.rpcLock.Lock()
+		waiter, ok := client.pending[delivery.CorrelationId]
+		client.rpcLock.Unlock()
+
+		if !ok {
+			continue // late reply
+		}
+
+		select {
+		case waiter.replies <- NewReceivedMessage(false, delivery):
+		default: // more replies than awaited
+		}
+	}
+
+	client.rpcLock.Lock()
+	defer client.rpcLock.Unlock()
+
+	if client.channel != channel {
+		return
+	}
+
+	for correlationID, waiter := range client.pending {
+		close(waiter.lost)
+		delete(client.pending, correlationID)
+	}
+
+	client.channel = nil
+}
+
+// receiveReturns hands the returns of unroutable mandatory requests to their calls, until the channel closes.
+func (client *RPCClient) receiveReturns(returns <-chan amqp.Return) {
+
+	for returned := range returns {
+		client.rpcLock.Lock()
+		waiter, ok := client.pending[returned.CorrelationId]
+		client.rpcLock.Unlock()
+
+		if !ok {
+			continue
+		}
+
+		select {
+		case waiter.returned <- returned:
+		default:
+		}
+	}
+}
+
+func requestReturnedError(correlationID string, returned amqp.Return) error {
+	return fmt.Errorf("%w: rpc request for CorrelationID %s: %d %s", ErrPublishReturned, correlationID, returned.ReplyCode, returned.ReplyText)
+}
+
+// RPCReplyError returns the error sent back by the server's RPCHandler wrapped in ErrRPCRemote, nil for a successful reply.
+func RPCReplyError(reply *ReceivedMessage) error {
+
+	if remote, ok := reply.Headers[RPCErrorHeader].(string); ok {
+		return fmt.Errorf("%w: %s", ErrRPCRemote, remote)
+	}
+
+	return nil
+}
+
+// RPCHandler processes a request and returns the body of the reply, or an error sent back to the RPCClient instead.
+type RPCHandler func(request *ReceivedMessage) ([]byte, error)
+
+// NewRPCReply creates the reply letter to a request, addressed to its ReplyTo with its CorrelationID.
+// A non nil err is sent in the RPCErrorHeader instead of the body.
+func NewRPCReply(request *ReceivedMessage, body []byte, err error) *Letter {
+
+	envelope := &Envelope{
+		RoutingKey:    request.ReplyTo,
+		ContentType:   request.ContentType,
+		CorrelationID: request.CorrelationID,
+		DeliveryMode:  amqp.Transient,
+		Headers:       amqp.Table{},
+	}
+
+	if err != nil {
+		envelope.Headers[RPCErrorHeader] = err.Error()
+		body = []byte{}
+	}
+
+	return &Letter{
+		LetterID: uuid.New(),
+		Body:     body,
+		Envelope: envelope,
+	}
+}
+
+// StartRPCServer starts the Consumer invoking the handler on every request, publishing its return value to the
+// request's ReplyTo. Requests are acknowledged once replied to, a reply that fails to publish is reported on Errors
+// and left for the RPCClient to time out on. Replies are published as is, without the Publisher's ClaimCheck or
+// chunking, since the RPCClient receives them straight off its reply channel.
+func (con *Consumer) StartRPCServer(publisher *Publisher, handler RPCHandler) {
+	con.StartConsumingWithAction(func(request *ReceivedMessage) {
+		con.serveRPC(publisher, handler, request)
+	})
+}
+
+func (con *Consumer) serveRPC(publisher *Publisher, handler RPCHandler, request *ReceivedMessage) {
+
+	body, err := handler(request)
+
+	if request.ReplyTo != "" {
+		if err := publisher.publishReply(NewRPCReply(request, body, err)); err != nil {
+			con.sendError(fmt.Errorf("failed to publish the rpc reply for CorrelationID %s: %w", request.CorrelationID, err))
+		}
+	}
+
+	if request.IsAckable {
+		if err := request.Acknowledge(); err != nil {
+			con.sendError(err)
+		}
+	}
+}
+
+// publishReply publishes the reply on a cached non-confirm ChannelHost, rate limited but never checked in or chunked.
+func (pub *Publisher) publishReply(reply *Letter) error {
+
+	release, err := pub.rateLimit(context.Background(), len(reply.Body), false)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return pub.publishNonConfirm(reply)
+}
@@ -0,0 +1,73 @@
+package tcr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+const defaultGatherCapacity = 1000
+
+// ErrQuorumNotReached is returned by ScatterGather when fewer successful replies than the Quorum arrived by the deadline.
+var ErrQuorumNotReached = errors.New("quorum of replies wasn't reached")
+
+// GatherOptions decide when ScatterGather stops collecting replies. Without a Count or Quorum it waits for the deadline.
+type GatherOptions struct {
+	Count  int // return as soon as this many successful replies arrived
+	Quorum int // return as soon as this many successful replies arrived, fewer by the deadline fail with ErrQuorumNotReached
+}
+
+// ScatterGather publishes the letter as one request, ex. to a fanout or topic exchange, and collects the replies
+// of every responder until the Count or Quorum is reached, whichever is first, or the context is done or the RPCConfig
+// Timeout expires. Every reply is returned, in order of arrival, including the ones carrying an RPCReplyError, which
+// don't count towards the Count or Quorum. The replies gathered so far are returned along with any error, a context
+// canceled by the caller (rather than past its deadline) always fails with its error.
+func (client *RPCClient) ScatterGather(ctx context.Context, letter *Letter, options *GatherOptions) ([]*ReceivedMessage, error) {
+
+	if options == nil {
+		options = &GatherOptions{}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, client.timeout)
+	defer cancel()
+
+	correlationID, waiter, err := client.request(ctx, letter, defaultGatherCapacity)
+	if err != nil {
+		return nil, err
+	}
+	defer client.forget(correlationID)
+
+	enough := options.Count
+	if options.Quorum > 0 && (enough <= 0 || options.Quorum < enough) {
+		enough = options.Quorum
+	}
+
+	replies := make([]*ReceivedMessage, 0)
+	succeeded := 0
+	for enough <= 0 || succeeded < enough {
+		select {
+		case reply := <-waiter.replies:
+			replies = append(replies, reply)
+			if RPCReplyError(reply) == nil {
+				succeeded++
+			}
+
+		case returned := <-waiter.returned:
+			return replies, requestReturnedError(correlationID, returned)
+
+		case <-waiter.lost:
+			return replies, ErrRPCReplyLost
+
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return replies, fmt.Errorf("rpc replies for CorrelationID %s weren't all gathered: %w", correlationID, ctx.Err())
+			}
+			if succeeded < options.Quorum {
+				return replies, fmt.Errorf("%w: %d of %d replies for CorrelationID %s", ErrQuorumNotReached, succeeded, options.Quorum, correlationID)
+			}
+			return replies, nil
+		}
+	}
+
+	return replies, nil
+}
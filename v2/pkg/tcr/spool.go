@@ -0,0 +1,503 @@
+package tcr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	spoolRecordPut byte = 1
+	spoolRecordAck byte = 2
+
+	spoolRecordHeaderSize  = 5 // type (1) + payload length (4)
+	spoolRecordTrailerSize = 4 // crc32 of type + payload
+
+	spoolSegmentExtension   = ".spool"
+	defaultSpoolSegmentSize = 16 * 1024 * 1024
+
+	defaultSpoolMaxAttempts  = 10
+	defaultSpoolRetryBackoff = time.Duration(1000) * time.Millisecond
+	maxSpoolRetryBackoff     = time.Duration(60) * time.Second
+)
+
+// Spool is a durable, on-disk write-ahead log of queued letters, made up of append-only segment files.
+// Letters are written when queued and only removed after an ack (publish confirmation) is recorded.
+// Segments are deleted, oldest first, once every letter they hold has been acked.
+type Spool struct {
+	directory      string
+	maxSegmentSize int64
+	syncWrites     bool
+	maxAttempts    int
+	retryBackoff   time.Duration
+	segments       []*spoolSegment
+	nextSegmentID  uint64
+	entries        map[uuid.UUID]*spoolEntry
+	queue          []*spoolEntry
+	closed         bool
+	spoolLock      *sync.Mutex
+}
+
+type spoolSegment struct {
+	id   uint64
+	path string
+	file *os.File // only the active (last) segment is kept open
+	size int64
+	live int // letters written to this segment that haven't been acked
+}
+
+type spoolEntry struct {
+	letter   *Letter
+	segment  *spoolSegment
+	queued   bool
+	attempts int       // failed publishes
+	retryAt  time.Time // held back until then after a failure
+}
+
+// NewSpool opens (or creates) a Spool in the configured directory and replays every letter that was never acked.
+// Replayed letters are queued in the order they were originally written.
+func NewSpool(config *SpoolConfig) (*Spool, error) {
+
+	if config.Directory == "" {
+		return nil, errors.New("spool directory can't be blank")
+	}
+
+	if err := os.MkdirAll(config.Directory, 0700); err != nil {
+		return nil, err
+	}
+
+	spool := &Spool{
+		directory:      config.Directory,
+		maxSegmentSize: int64(config.MaxSegmentSize),
+		syncWrites:     config.SyncWrites,
+		maxAttempts:    defaultSpoolMaxAttempts,
+		retryBackoff:   defaultSpoolRetryBackoff,
+		entries:        make(map[uuid.UUID]*spoolEntry),
+		queue:          make([]*spoolEntry, 0),
+		spoolLock:      &sync.Mutex{},
+	}
+
+	if spool.maxSegmentSize <= 0 {
+		spool.maxSegmentSize = defaultSpoolSegmentSize
+	}
+	if config.MaxAttempts > 0 {
+		spool.maxAttempts = config.MaxAttempts
+	}
+	if config.RetryBackoff > 0 {
+		spool.retryBackoff = time.Duration(config.RetryBackoff) * time.Millisecond
+	}
+
+	if err := spool.replay(); err != nil {
+		return nil, err
+	}
+
+	// Always write to a fresh segment, so replayed segments can be removed once drained.
+	if err := spool.rotate(); err != nil {
+		return nil, err
+	}
+
+	spool.compact()
+
+	return spool, nil
+}
+
+// Append durably writes the letter to the spool and queues it for publishing.
+// Appending a letter that is still pending (ex. a retry) re-queues it without writing it again.
+func (s *Spool) Append(letter *Letter) error {
+	s.spoolLock.Lock()
+	defer s.spoolLock.Unlock()
+
+	if s.closed {
+		return errors.New("can't append to a closed spool")
+	}
+
+	if entry, ok := s.entries[letter.LetterID]; ok {
+		if !entry.queued {
+			entry.queued = true
+			s.queue = append(s.queue, entry)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+
+	segment, err := s.writeRecord(spoolRecordPut, data)
+	if err != nil {
+		return err
+	}
+
+	entry := &spoolEntry{
+		letter:  letter,
+		segment: segment,
+		queued:  true,
+	}
+
+	segment.live++
+	s.entries[letter.LetterID] = entry
+	s.queue = append(s.queue, entry)
+
+	return nil
+}
+
+// Dequeue hands out the oldest queued letter. The letter stays in the spool until it is acked.
+// Nothing is handed out while the oldest letter backs off after a failure, keeping the letters in order.
+func (s *Spool) Dequeue() (*Letter, bool) {
+	s.spoolLock.Lock()
+	defer s.spoolLock.Unlock()
+
+	if len(s.queue) == 0 || time.Now().Before(s.queue[0].retryAt) {
+		return nil, false
+	}
+
+	entry := s.queue[0]
+	s.queue[0] = nil
+	s.queue = s.queue[1:]
+	entry.queued = false
+
+	return entry.letter, true
+}
+
+// Peek returns up to limit of the oldest queued letters without handing them out.
+func (s *Spool) Peek(limit int) []*Letter {
+	s.spoolLock.Lock()
+	defer s.spoolLock.Unlock()
+
+	if limit > len(s.queue) {
+		limit = len(s.queue)
+	}
+
+	letters := make([]*Letter, 0, limit)
+	for _, entry := range s.queue[:limit] {
+		letters = append(letters, entry.letter)
+	}
+
+	return letters
+}
+
+// Requeue puts a pending letter, that failed to publish, back at the front of the queue once a backoff passed,
+// doubling from the SpoolConfig RetryBackoff with every failure. Returns false when the letter ran out of
+// SpoolConfig MaxAttempts instead, it's then removed from the spool like an acked letter.
+func (s *Spool) Requeue(letterID uuid.UUID) bool {
+	s.spoolLock.Lock()
+	defer s.spoolLock.Unlock()
+
+	entry, ok := s.entries[letterID]
+	if !ok {
+		return false
+	}
+	if entry.queued {
+		return true
+	}
+
+	entry.attempts++
+	if entry.attempts >= s.maxAttempts {
+		if !s.closed {
+			_, _ = s.writeRecord(spoolRecordAck, letterID[:])
+		}
+		delete(s.entries, letterID)
+		entry.segment.live--
+		s.compact()
+		return false
+	}
+
+	backoff := s.retryBackoff << uint(entry.attempts-1)
+	if backoff > maxSpoolRetryBackoff || backoff <= 0 {
+		backoff = maxSpoolRetryBackoff
+	}
+
+	entry.retryAt = time.Now().Add(backoff)
+	entry.queued = true
+	s.queue = append([]*spoolEntry{entry}, s.queue...)
+
+	return true
+}
+
+// Ack durably records that the letter was confirmed by the server, removing it from the spool.
+func (s *Spool) Ack(letterID uuid.UUID) error {
+	s.spoolLock.Lock()
+	defer s.spoolLock.Unlock()
+
+	if s.closed {
+		return errors.New("can't ack on a closed spool")
+	}
+
+	entry, ok := s.entries[letterID]
+	if !ok {
+		return nil
+	}
+
+	if _, err := s.writeRecord(spoolRecordAck, letterID[:]); err != nil {
+		return err
+	}
+
+	delete(s.entries, letterID)
+	entry.segment.live--
+	if entry.queued {
+		s.removeFromQueue(entry)
+	}
+
+	s.compact()
+
+	return nil
+}
+
+// Pending returns the count of letters in the spool that have not been acked yet.
+func (s *Spool) Pending() int {
+	s.spoolLock.Lock()
+	defer s.spoolLock.Unlock()
+
+	return len(s.entries)
+}
+
+// Queued returns the count of letters waiting to be handed out by Dequeue.
+func (s *Spool) Queued() int {
+	s.spoolLock.Lock()
+	defer s.spoolLock.Unlock()
+
+	return len(s.queue)
+}
+
+// Close closes the active segment file. Pending letters are replayed the next time the Spool is opened.
+func (s *Spool) Close() error {
+	s.spoolLock.Lock()
+	defer s.spoolLock.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	s.closed = true
+
+	active := s.segments[len(s.segments)-1]
+	if active.file == nil {
+		return nil
+	}
+
+	err := active.file.Close()
+	active.file = nil
+
+	return err
+}
+
+func (s *Spool) removeFromQueue(target *spoolEntry) {
+	for i, entry := range s.queue {
+		if entry == target {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// writeRecord appends a record to the active segment, rolling over to a new segment when full.
+func (s *Spool) writeRecord(recordType byte, payload []byte) (*spoolSegment, error) {
+
+	active := s.segments[len(s.segments)-1]
+	if active.size >= s.maxSegmentSize {
+		if err := s.rotate(); err != nil {
+			return nil, err
+		}
+		active = s.segments[len(s.segments)-1]
+	}
+
+	record := make([]byte, spoolRecordHeaderSize+len(payload)+spoolRecordTrailerSize)
+	record[0] = recordType
+	binary.BigEndian.PutUint32(record[1:spoolRecordHeaderSize], uint32(len(payload)))
+	copy(record[spoolRecordHeaderSize:], payload)
+	binary.BigEndian.PutUint32(
+		record[spoolRecordHeaderSize+len(payload):],
+		spoolChecksum(recordType, payload))
+
+	if _, err := active.file.Write(record); err != nil {
+		// Don't leave a torn record behind, it would hide every record written after it on replay.
+		_ = active.file.Truncate(active.size)
+		return nil, err
+	}
+	active.size += int64(len(record))
+
+	if s.syncWrites {
+		if err := active.file.Sync(); err != nil {
+			return nil, err
+		}
+	}
+
+	return active, nil
+}
+
+// rotate closes the active segment and starts a new one.
+func (s *Spool) rotate() error {
+
+	path := filepath.Join(s.directory, fmt.Sprintf("%020d%s", s.nextSegmentID, spoolSegmentExtension))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	if len(s.segments) > 0 {
+		previous := s.segments[len(s.segments)-1]
+		if previous.file != nil {
+			_ = previous.file.Close()
+			previous.file = nil
+		}
+	}
+
+	s.segments = append(s.segments, &spoolSegment{
+		id:   s.nextSegmentID,
+		path: path,
+		file: file,
+	})
+	s.nextSegmentID++
+
+	return nil
+}
+
+// compact deletes the oldest segments whose letters have all been acked.
+// Segments are only removed in order so an ack record is never lost before the letter it acks.
+func (s *Spool) compact() {
+
+	for len(s.segments) > 1 && s.segments[0].live == 0 {
+		_ = os.Remove(s.segments[0].path)
+		s.segments[0] = nil
+		s.segments = s.segments[1:]
+	}
+}
+
+// replay reads every segment in order, rebuilding the pending letters. A torn record at the end
+// of a segment (ex. crash mid-write) is truncated away.
+func (s *Spool) replay() error {
+
+	files, err := ioutil.ReadDir(s.directory)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), spoolSegmentExtension) {
+			continue
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSuffix(file.Name(), spoolSegmentExtension), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		s.segments = append(s.segments, &spoolSegment{
+			id:   id,
+			path: filepath.Join(s.directory, file.Name()),
+		})
+	}
+
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].id < s.segments[j].id })
+
+	for _, segment := range s.segments {
+		if err := s.replaySegment(segment); err != nil {
+			return err
+		}
+
+		if segment.id >= s.nextSegmentID {
+			s.nextSegmentID = segment.id + 1
+		}
+	}
+
+	// Drop the letters acked later in the log, a LetterID put again after its ack is only queued once.
+	queue := s.queue[:0]
+	for _, entry := range s.queue {
+		if s.entries[entry.letter.LetterID] == entry {
+			entry.queued = true
+			queue = append(queue, entry)
+		}
+	}
+	s.queue = queue
+
+	return nil
+}
+
+func (s *Spool) replaySegment(segment *spoolSegment) error {
+
+	data, err := ioutil.ReadFile(segment.path)
+	if err != nil {
+		return err
+	}
+
+	offset := 0
+	for offset+spoolRecordHeaderSize <= len(data) {
+		recordType := data[offset]
+		length := int(binary.BigEndian.Uint32(data[offset+1 : offset+spoolRecordHeaderSize]))
+
+		end := offset + spoolRecordHeaderSize + length + spoolRecordTrailerSize
+		if end > len(data) {
+			break
+		}
+
+		payload := data[offset+spoolRecordHeaderSize : end-spoolRecordTrailerSize]
+		if binary.BigEndian.Uint32(data[end-spoolRecordTrailerSize:end]) != spoolChecksum(recordType, payload) {
+			break
+		}
+
+		s.replayRecord(segment, recordType, payload)
+		offset = end
+	}
+
+	if offset < len(data) {
+		if err := os.Truncate(segment.path, int64(offset)); err != nil {
+			return err
+		}
+	}
+
+	segment.size = int64(offset)
+
+	return nil
+}
+
+func (s *Spool) replayRecord(segment *spoolSegment, recordType byte, payload []byte) {
+
+	switch recordType {
+	case spoolRecordPut:
+		letter := &Letter{}
+		if err := json.Unmarshal(payload, letter); err != nil {
+			return
+		}
+
+		if _, ok := s.entries[letter.LetterID]; ok {
+			return
+		}
+
+		entry := &spoolEntry{
+			letter:  letter,
+			segment: segment,
+		}
+
+		segment.live++
+		s.entries[letter.LetterID] = entry
+		s.queue = append(s.queue, entry)
+
+	case spoolRecordAck:
+		letterID, err := uuid.FromBytes(payload)
+		if err != nil {
+			return
+		}
+
+		if entry, ok := s.entries[letterID]; ok {
+			entry.segment.live--
+			delete(s.entries, letterID)
+		}
+	}
+}
+
+func spoolChecksum(recordType byte, payload []byte) uint32 {
+	checksum := crc32.Update(0, crc32.IEEETable, []byte{recordType})
+	return crc32.Update(checksum, crc32.IEEETable, payload)
+}
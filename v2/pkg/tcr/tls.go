@@ -3,9 +3,33 @@ package tcr
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	amqpPort  = 5672
+	amqpsPort = 5671
 )
 
+// ExternalAuth is the SASL EXTERNAL mechanism, authenticating with the client certificate presented during the TLS handshake.
+type ExternalAuth struct{}
+
+// Mechanism returns "EXTERNAL"
+func (auth *ExternalAuth) Mechanism() string {
+	return "EXTERNAL"
+}
+
+// Response returns an empty response, the identity comes from the client certificate.
+func (auth *ExternalAuth) Response() string {
+	return ""
+}
+
 // CreateTLSConfig creates a x509 TLS Config for use in TLS-based communication.
 func CreateTLSConfig(pemLocation string, localLocation string) (*tls.Config, error) {
 	cfg := new(tls.Config)
@@ -28,3 +52,114 @@ func CreateTLSConfig(pemLocation string, localLocation string) (*tls.Config, err
 	cfg.Certificates = append(cfg.Certificates, cert)
 	return cfg, nil
 }
+
+// CreateTLSConfigFromConfig creates a x509 TLS Config from all the settings in a TLSConfig.
+// Files are read from disk every time this is called so rotated certificates are picked up on the next connect.
+func CreateTLSConfigFromConfig(config *TLSConfig) (*tls.Config, error) {
+
+	cfg := &tls.Config{
+		ServerName:         config.CertServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+
+	// Blank uses the host's root CA set.
+	if config.PEMCertLocation != "" {
+		ca, err := ioutil.ReadFile(config.PEMCertLocation)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if ok := cfg.RootCAs.AppendCertsFromPEM(ca); !ok {
+			return nil, fmt.Errorf("no certificates could be parsed from CA bundle %q", config.PEMCertLocation)
+		}
+	}
+
+	if config.LocalCertLocation != "" {
+		keyLocation := config.LocalKeyLocation
+		if keyLocation == "" {
+			keyLocation = config.LocalCertLocation
+		}
+
+		cert, err := tls.LoadX509KeyPair(config.LocalCertLocation, keyLocation)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+
+	if config.UseExternalAuth && len(cfg.Certificates) == 0 {
+		return nil, errors.New("sasl external authentication requires a client certificate")
+	}
+
+	if config.MinVersion != "" {
+		version, err := parseTLSVersion(config.MinVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.MinVersion = version
+	}
+
+	return cfg, nil
+}
+
+// CreateTLSURI converts an AMQP URI to its AMQPS equivalent, keeping credentials and vhost.
+// The default AMQP port is swapped for the default AMQPS port.
+func CreateTLSURI(uri string) (string, error) {
+
+	amqpURI, err := amqp.ParseURI(uri)
+	if err != nil {
+		return "", err
+	}
+
+	if amqpURI.Scheme == "amqps" {
+		return uri, nil
+	}
+
+	amqpURI.Scheme = "amqps"
+	if amqpURI.Port == amqpPort {
+		amqpURI.Port = amqpsPort
+	}
+
+	return amqpURI.String(), nil
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+
+	switch version {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported tls version %q", version)
+	}
+}
+
+// tlsFilesModTime returns the most recent modification time of the files referenced in the TLSConfig.
+func tlsFilesModTime(config *TLSConfig) time.Time {
+
+	var latest time.Time
+	for _, location := range []string{config.PEMCertLocation, config.LocalCertLocation, config.LocalKeyLocation} {
+		if location == "" {
+			continue
+		}
+
+		info, err := os.Stat(location)
+		if err != nil {
+			continue
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest
+}
@@ -17,6 +17,7 @@ const (
 // Topologer allows you to build RabbitMQ topology backed by a ConnectionPool.
 type Topologer struct {
 	ConnectionPool *ConnectionPool
+	channel        *amqp.Channel // when set, every declaration uses this channel
 }
 
 // NewTopologer builds you a new Topologer.
@@ -27,6 +28,35 @@ func NewTopologer(cp *ConnectionPool) *Topologer {
 	}
 }
 
+// newChannelTopologer builds a Topologer declaring on the channel, ex. so exclusive queues belong to its connection.
+func newChannelTopologer(channel *amqp.Channel) *Topologer {
+
+	return &Topologer{
+		channel: channel,
+	}
+}
+
+// getChannel uses a cached non-confirm channel when the pool has them, otherwise a transient channel.
+// The release func returns the channel, recreating a cached channel the server closed on error.
+func (top *Topologer) getChannel() (*amqp.Channel, func(error)) {
+
+	if top.channel != nil {
+		return top.channel, func(error) {}
+	}
+
+	if top.ConnectionPool.Config.MaxCacheNonConfirmChannelCount > 0 {
+		chanHost := top.ConnectionPool.GetNonConfirmChannelFromPool()
+		return chanHost.Channel, func(err error) {
+			top.ConnectionPool.ReturnChannel(chanHost, err != nil)
+		}
+	}
+
+	channel := top.ConnectionPool.GetTransientChannel(false)
+	return channel, func(error) {
+		channel.Close()
+	}
+}
+
 // BuildTopology builds a topology based on a TopologyConfig - stops on first error.
 func (top *Topologer) BuildTopology(config *TopologyConfig, ignoreErrors bool) error {
 
@@ -126,10 +156,10 @@ func (top *Topologer) CreateExchange(
 	exchangeName string,
 	exchangeType string,
 	passiveDeclare, durable, autoDelete, internal, noWait bool,
-	args map[string]interface{}) error {
+	args map[string]interface{}) (err error) {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
-	defer channel.Close()
+	channel, release := top.getChannel()
+	defer func() { release(err) }()
 
 	if passiveDeclare {
 		return channel.ExchangeDeclarePassive(exchangeName, exchangeType, durable, autoDelete, internal, noWait, amqp.Table(args))
@@ -139,10 +169,10 @@ func (top *Topologer) CreateExchange(
 }
 
 // CreateExchangeFromConfig builds an Exchange topology from a config Exchange element.
-func (top *Topologer) CreateExchangeFromConfig(exchange *Exchange) error {
+func (top *Topologer) CreateExchangeFromConfig(exchange *Exchange) (err error) {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
-	defer channel.Close()
+	channel, release := top.getChannel()
+	defer func() { release(err) }()
 
 	if exchange.PassiveDeclare {
 		return channel.ExchangeDeclarePassive(
@@ -166,10 +196,10 @@ func (top *Topologer) CreateExchangeFromConfig(exchange *Exchange) error {
 }
 
 // ExchangeBind binds an exchange to an Exchange.
-func (top *Topologer) ExchangeBind(exchangeBinding *ExchangeBinding) error {
+func (top *Topologer) ExchangeBind(exchangeBinding *ExchangeBinding) (err error) {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
-	defer channel.Close()
+	channel, release := top.getChannel()
+	defer func() { release(err) }()
 
 	return channel.ExchangeBind(
 		exchangeBinding.ExchangeName,
@@ -182,19 +212,19 @@ func (top *Topologer) ExchangeBind(exchangeBinding *ExchangeBinding) error {
 // ExchangeDelete removes the exchange from the server.
 func (top *Topologer) ExchangeDelete(
 	exchangeName string,
-	ifUnused, noWait bool) error {
+	ifUnused, noWait bool) (err error) {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
-	defer channel.Close()
+	channel, release := top.getChannel()
+	defer func() { release(err) }()
 
 	return channel.ExchangeDelete(exchangeName, ifUnused, noWait)
 }
 
 // ExchangeUnbind removes the binding of an Exchange to an Exchange.
-func (top *Topologer) ExchangeUnbind(exchangeName, routingKey, parentExchangeName string, noWait bool, args map[string]interface{}) error {
+func (top *Topologer) ExchangeUnbind(exchangeName, routingKey, parentExchangeName string, noWait bool, args map[string]interface{}) (err error) {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
-	defer channel.Close()
+	channel, release := top.getChannel()
+	defer func() { release(err) }()
 
 	return channel.ExchangeUnbind(
 		exchangeName,
@@ -212,25 +242,25 @@ func (top *Topologer) CreateQueue(
 	autoDelete bool,
 	exclusive bool,
 	noWait bool,
-	args map[string]interface{}) error {
+	args map[string]interface{}) (err error) {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
-	defer channel.Close()
+	channel, release := top.getChannel()
+	defer func() { release(err) }()
 
 	if passiveDeclare {
-		_, err := channel.QueueDeclarePassive(queueName, durable, autoDelete, exclusive, noWait, amqp.Table(args))
+		_, err = channel.QueueDeclarePassive(queueName, durable, autoDelete, exclusive, noWait, amqp.Table(args))
 		return err
 	}
 
-	_, err := channel.QueueDeclare(queueName, durable, autoDelete, exclusive, noWait, amqp.Table(args))
+	_, err = channel.QueueDeclare(queueName, durable, autoDelete, exclusive, noWait, amqp.Table(args))
 	return err
 }
 
 // CreateQueueFromConfig builds a Queue topology from a config Exchange element.
-func (top *Topologer) CreateQueueFromConfig(queue *Queue) error {
+func (top *Topologer) CreateQueueFromConfig(queue *Queue) (err error) {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
-	defer channel.Close()
+	channel, release := top.getChannel()
+	defer func() { release(err) }()
 
 	// classic is automatic and supports all classic properties, quorum type does not so this helps keep things functional
 	if queue.Type == QueueTypeQuorum {
@@ -247,28 +277,28 @@ func (top *Topologer) CreateQueueFromConfig(queue *Queue) error {
 	}
 
 	if queue.PassiveDeclare {
-		_, err := channel.QueueDeclarePassive(queue.Name, queue.Durable, queue.AutoDelete, queue.Exclusive, queue.NoWait, queue.Args)
+		_, err = channel.QueueDeclarePassive(queue.Name, queue.Durable, queue.AutoDelete, queue.Exclusive, queue.NoWait, queue.Args)
 		return err
 	}
 
-	_, err := channel.QueueDeclare(queue.Name, queue.Durable, queue.AutoDelete, queue.Exclusive, queue.NoWait, queue.Args)
+	_, err = channel.QueueDeclare(queue.Name, queue.Durable, queue.AutoDelete, queue.Exclusive, queue.NoWait, queue.Args)
 	return err
 }
 
 // QueueDelete removes the queue from the server (and all bindings) and returns messages purged (count).
-func (top *Topologer) QueueDelete(name string, ifUnused, ifEmpty, noWait bool) (int, error) {
+func (top *Topologer) QueueDelete(name string, ifUnused, ifEmpty, noWait bool) (count int, err error) {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
-	defer channel.Close()
+	channel, release := top.getChannel()
+	defer func() { release(err) }()
 
 	return channel.QueueDelete(name, ifUnused, ifEmpty, noWait)
 }
 
 // QueueBind binds an Exchange to a Queue.
-func (top *Topologer) QueueBind(queueBinding *QueueBinding) error {
+func (top *Topologer) QueueBind(queueBinding *QueueBinding) (err error) {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
-	defer channel.Close()
+	channel, release := top.getChannel()
+	defer func() { release(err) }()
 
 	return channel.QueueBind(
 		queueBinding.QueueName,
@@ -299,10 +329,10 @@ func (top *Topologer) PurgeQueues(queueNames []string, noWait bool) (int, error)
 }
 
 // PurgeQueue removes all messages from the Queue that are not waiting to be Acknowledged and returns the count.
-func (top *Topologer) PurgeQueue(queueName string, noWait bool) (int, error) {
+func (top *Topologer) PurgeQueue(queueName string, noWait bool) (count int, err error) {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
-	defer channel.Close()
+	channel, release := top.getChannel()
+	defer func() { release(err) }()
 
 	return channel.QueuePurge(
 		queueName,
@@ -310,10 +340,10 @@ func (top *Topologer) PurgeQueue(queueName string, noWait bool) (int, error) {
 }
 
 // UnbindQueue removes the binding of a Queue to an Exchange.
-func (top *Topologer) UnbindQueue(queueName, routingKey, exchangeName string, args map[string]interface{}) error {
+func (top *Topologer) UnbindQueue(queueName, routingKey, exchangeName string, args map[string]interface{}) (err error) {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
-	defer channel.Close()
+	channel, release := top.getChannel()
+	defer func() { release(err) }()
 
 	return channel.QueueUnbind(
 		queueName,
@@ -0,0 +1,115 @@
+package main_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/tiggerite/turbocookedrabbit/v2/pkg/tcr"
+)
+
+func chunkMessages(chunks []*tcr.Letter) []*tcr.ReceivedMessage {
+
+	msgs := make([]*tcr.ReceivedMessage, 0, len(chunks))
+	for _, chunk := range chunks {
+		msgs = append(msgs, tcr.NewReceivedMessage(false, amqp.Delivery{
+			Headers:       amqp.Table(chunk.Envelope.Headers),
+			CorrelationId: chunk.Envelope.CorrelationID,
+			MessageId:     chunk.LetterID.String(),
+			Body:          chunk.Body,
+		}))
+	}
+
+	return msgs
+}
+
+func TestSplitLetter(t *testing.T) {
+
+	letter := tcr.CreateMockLetter("", "TcrTestQueue", []byte("0123456789"))
+
+	assert.Len(t, tcr.SplitLetter(letter, 10), 1)
+
+	chunks := tcr.SplitLetter(letter, 4)
+	assert.Len(t, chunks, 3)
+	assert.Equal(t, []byte("89"), chunks[2].Body)
+
+	for index, chunk := range chunks {
+		assert.Equal(t, letter.LetterID, chunk.LetterID)
+		assert.Equal(t, letter.LetterID.String(), chunk.Envelope.CorrelationID)
+		assert.Equal(t, int64(index), chunk.Envelope.Headers[tcr.ChunkIndexHeader])
+		assert.Equal(t, int64(3), chunk.Envelope.Headers[tcr.ChunkCountHeader])
+	}
+
+	assert.NotContains(t, letter.Envelope.Headers, tcr.ChunkIDHeader)
+	assert.Empty(t, letter.Envelope.CorrelationID)
+}
+
+func TestReassemblerOutOfOrder(t *testing.T) {
+
+	reassembler := tcr.NewReassembler(&tcr.ChunkingConfig{Enabled: true})
+
+	letter := tcr.CreateMockLetter("", "TcrTestQueue", []byte("Hello chunked World"))
+	letter.Envelope.Headers = map[string]interface{}{"x-custom": "kept"}
+	msgs := chunkMessages(tcr.SplitLetter(letter, 5))
+
+	// Plain messages pass through.
+	plain := tcr.NewReceivedMessage(false, amqp.Delivery{Body: []byte("plain")})
+	msg, err := reassembler.Add(plain)
+	assert.NoError(t, err)
+	assert.Same(t, plain, msg)
+
+	for _, index := range []int{2, 0, 3} {
+		msg, err = reassembler.Add(msgs[index])
+		assert.NoError(t, err)
+		assert.Nil(t, msg)
+	}
+
+	pending, bytes := reassembler.Pending()
+	assert.Equal(t, 1, pending)
+	assert.Equal(t, 14, bytes)
+
+	msg, err = reassembler.Add(msgs[1])
+	assert.NoError(t, err)
+	assert.NotNil(t, msg)
+	assert.Equal(t, letter.Body, msg.Body)
+	assert.Equal(t, "kept", msg.Headers["x-custom"])
+	assert.NotContains(t, msg.Headers, tcr.ChunkIndexHeader)
+
+	pending, bytes = reassembler.Pending()
+	assert.Equal(t, 0, pending)
+	assert.Equal(t, 0, bytes)
+}
+
+func TestReassemblerLimits(t *testing.T) {
+
+	reassembler := tcr.NewReassembler(&tcr.ChunkingConfig{
+		Enabled:            true,
+		ReassemblyTimeout:  10,
+		MaxReassemblyBytes: 8,
+	})
+
+	letter := tcr.CreateMockLetter("", "TcrTestQueue", []byte("0123456789"))
+	msgs := chunkMessages(tcr.SplitLetter(letter, 5))
+
+	_, err := reassembler.Add(msgs[0])
+	assert.NoError(t, err)
+
+	_, err = reassembler.Add(msgs[1])
+	assert.True(t, errors.Is(err, tcr.ErrReassemblyOverflow))
+
+	pending, _ := reassembler.Pending()
+	assert.Equal(t, 0, pending)
+
+	_, err = reassembler.Add(msgs[0])
+	assert.NoError(t, err)
+	assert.Empty(t, reassembler.Expire(time.Now()))
+	assert.Len(t, reassembler.Expire(time.Now().Add(time.Second)), 1)
+
+	malformed := tcr.NewReceivedMessage(false, amqp.Delivery{
+		Headers: amqp.Table{tcr.ChunkIDHeader: "id", tcr.ChunkIndexHeader: int64(3), tcr.ChunkCountHeader: int64(2)},
+	})
+	_, err = reassembler.Add(malformed)
+	assert.Error(t, err)
+}
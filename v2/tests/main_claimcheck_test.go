@@ -0,0 +1,141 @@
+package main_test
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/tiggerite/turbocookedrabbit/v2/pkg/tcr"
+)
+
+func TestFileBlobStore(t *testing.T) {
+
+	store, err := tcr.NewFileBlobStore(t.TempDir())
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	assert.NoError(t, store.Put(ctx, "blob", []byte("Hello World")))
+
+	data, err := store.Get(ctx, "blob")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("Hello World"), data)
+
+	assert.NoError(t, store.Delete(ctx, "blob"))
+	assert.NoError(t, store.Delete(ctx, "blob"))
+
+	_, err = store.Get(ctx, "blob")
+	assert.Error(t, err)
+
+	assert.Error(t, store.Put(ctx, "../escape", []byte("nope")))
+	assert.Error(t, store.Put(ctx, "", []byte("nope")))
+}
+
+func TestClaimCheckInAndOut(t *testing.T) {
+
+	claimCheck, err := tcr.NewClaimCheckFromConfig(&tcr.ClaimCheckConfig{
+		Enabled:         true,
+		Directory:       t.TempDir(),
+		Threshold:       8,
+		DeleteAfterRead: true,
+	})
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+
+	small := tcr.CreateMockLetter("", "TcrTestQueue", []byte("small"))
+	checkedIn, err := claimCheck.CheckIn(ctx, small)
+	assert.NoError(t, err)
+	assert.Same(t, small, checkedIn)
+
+	large := tcr.CreateMockLetter("", "TcrTestQueue", []byte("this body is over the threshold"))
+	checkedIn, err = claimCheck.CheckIn(ctx, large)
+	assert.NoError(t, err)
+	assert.Empty(t, checkedIn.Body)
+	assert.Equal(t, large.LetterID, checkedIn.LetterID)
+	assert.Equal(t, large.LetterID.String(), checkedIn.Envelope.Headers[tcr.ClaimCheckHeader])
+	assert.NotContains(t, large.Envelope.Headers, tcr.ClaimCheckHeader)
+
+	// Auto-acked messages delete the blob as soon as it's checked out.
+	msg := tcr.NewReceivedMessage(false, amqp.Delivery{Headers: amqp.Table(checkedIn.Envelope.Headers)})
+	assert.NoError(t, claimCheck.CheckOut(ctx, msg))
+	assert.Equal(t, large.Body, msg.Body)
+
+	_, err = claimCheck.Store.Get(ctx, large.LetterID.String())
+	assert.Error(t, err)
+
+	// The blob is gone so it can't be checked out again.
+	msg = tcr.NewReceivedMessage(false, amqp.Delivery{Headers: amqp.Table(checkedIn.Envelope.Headers)})
+	assert.Error(t, claimCheck.CheckOut(ctx, msg))
+}
+
+func TestClaimCheckBodyNotLeftBehindOnFailure(t *testing.T) {
+
+	broker := newFakeBroker(t, nil) // never confirms
+
+	pool, err := tcr.NewConnectionPool(&tcr.PoolConfig{
+		URI:                  broker.URI(),
+		Heartbeat:            60,
+		ConnectionTimeout:    10,
+		MaxConnectionCount:   1,
+		MaxCacheChannelCount: 2,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer pool.Shutdown()
+
+	directory := t.TempDir()
+	claimCheck, err := tcr.NewClaimCheckFromConfig(&tcr.ClaimCheckConfig{
+		Enabled:   true,
+		Directory: directory,
+		Threshold: 8,
+	})
+	assert.NoError(t, err)
+
+	limiter := tcr.NewRateLimiter(&tcr.RateLimitConfig{
+		MaxInFlight: 1,
+		FailFast:    true,
+	})
+
+	publisher := tcr.NewPublisherFromConfig(&tcr.RabbitSeasoning{
+		PublisherConfig: &tcr.PublisherConfig{PublishTimeOutInterval: 50},
+	}, pool)
+	publisher.UseClaimCheck(claimCheck)
+	publisher.UseRateLimiter(limiter)
+	defer publisher.Shutdown(false)
+
+	blobs := func() int {
+		files, err := ioutil.ReadDir(directory)
+		assert.NoError(t, err)
+		return len(files)
+	}
+
+	large := tcr.CreateMockLetter("", "TcrTestQueue", []byte("this body is over the threshold"))
+
+	// Rate limited letters are never checked in.
+	release, err := limiter.Acquire(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, publisher.PublishWithConfirmationError(large, 0), tcr.ErrRateLimited)
+	assert.Equal(t, 0, blobs())
+	release()
+
+	// Letters failing to publish have their checked in body deleted, and keep it in the receipt for a retry.
+	assert.Error(t, publisher.PublishWithConfirmationError(large, 0))
+	assert.Equal(t, 0, blobs())
+
+	publisher.PublishWithConfirmation(large, 0)
+	select {
+	case receipt := <-publisher.PublishReceipts():
+		assert.False(t, receipt.Success)
+		if assert.NotNil(t, receipt.FailedLetter) {
+			assert.Equal(t, large.Body, receipt.FailedLetter.Body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("test timeout")
+	}
+	assert.Equal(t, 0, blobs())
+	assert.Equal(t, 0, limiter.InFlight())
+}
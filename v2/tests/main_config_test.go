@@ -1,7 +1,9 @@
 package main_test
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/tiggerite/turbocookedrabbit/v2/pkg/tcr"
@@ -17,3 +19,41 @@ func TestReadConfig(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotEqual(t, "", config.PoolConfig.URI, "RabbitMQ URI should not be blank.")
 }
+
+func TestReadConfigClientProperties(t *testing.T) {
+	fileNamePath := "testseasoning.json"
+
+	config, err := tcr.ConvertJSONFileToConfig(fileNamePath)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "TurboCookedRabbit", config.PoolConfig.ClientProperties["product"])
+	assert.Nil(t, config.PoolConfig.Dial)
+}
+
+func TestNestedClientProperties(t *testing.T) {
+
+	broker := newFakeBroker(t, nil)
+
+	config := &tcr.PoolConfig{}
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"URI": "`+broker.URI()+`",
+		"Heartbeat": 60,
+		"ConnectionTimeout": 10,
+		"ClientProperties": {
+			"product": "TurboCookedRabbit",
+			"features": { "tracing": true, "limits": { "prefetch": 100 } },
+			"regions": [ "eu-west", { "zone": "b" } ]
+		}
+	}`), config))
+
+	connHost, err := tcr.NewConnectionHostFromConfig(config, "tcr-properties", 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer connHost.Connection.Close()
+
+	properties := string(broker.NextHandshake(t, 5*time.Second).ClientProperties)
+	for _, key := range []string{"features", "tracing", "limits", "prefetch", "regions", "zone"} {
+		assert.Contains(t, properties, key)
+	}
+}
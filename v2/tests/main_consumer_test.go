@@ -1,10 +1,15 @@
 package main_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/fortytw2/leaktest"
+	"github.com/streadway/amqp"
 	"github.com/stretchr/testify/assert"
 	"github.com/tiggerite/turbocookedrabbit/v2/pkg/tcr"
 )
@@ -64,3 +69,456 @@ func TestConsumerGet(t *testing.T) {
 
 	TestCleanup(t)
 }
+
+func TestNewReceivedMessageProperties(t *testing.T) {
+
+	timestamp := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	msg := tcr.NewReceivedMessage(false, amqp.Delivery{
+		MessageId:       "order-1",
+		AppId:           "orders",
+		ContentType:     "application/json",
+		ContentEncoding: "gzip",
+		CorrelationId:   "correlation-1",
+		ReplyTo:         "amq.rabbitmq.reply-to",
+		Expiration:      "60000",
+		UserId:          "guest",
+		Type:            "OrderCreated",
+		Timestamp:       timestamp,
+		Priority:        5,
+		DeliveryMode:    2,
+	})
+
+	assert.Equal(t, "order-1", msg.MessageID)
+	assert.Equal(t, "orders", msg.ApplicationID)
+	assert.Equal(t, "gzip", msg.ContentEncoding)
+	assert.Equal(t, "correlation-1", msg.CorrelationID)
+	assert.Equal(t, "amq.rabbitmq.reply-to", msg.ReplyTo)
+	assert.Equal(t, "60000", msg.Expiration)
+	assert.Equal(t, "guest", msg.UserID)
+	assert.Equal(t, "OrderCreated", msg.Type)
+	assert.Equal(t, timestamp, msg.Timestamp)
+	assert.Equal(t, uint8(5), msg.Priority)
+}
+
+func TestConsumerGetEnvelopeProperties(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+
+	timestamp := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	letter := tcr.CreateMockRandomLetter("TcrTestQueue")
+	letter.Envelope.MessageID = "order-1"
+	letter.Envelope.Timestamp = timestamp
+	letter.Envelope.AppID = "orders"
+	letter.Envelope.ReplyTo = "TcrTestReplyQueue"
+	letter.Envelope.Expiration = "60000"
+	letter.Envelope.ContentEncoding = "identity"
+
+	assert.NoError(t, publisher.PublishWithConfirmationError(letter, time.Second))
+
+	consumer := tcr.NewConsumerFromConfig(ConsumerConfig, ConnectionPool)
+	delivery, err := consumer.Get("TcrTestQueue")
+	assert.NoError(t, err)
+	assert.NotNil(t, delivery)
+
+	assert.Equal(t, "order-1", delivery.MessageId)
+	assert.Equal(t, timestamp, delivery.Timestamp.UTC())
+	assert.Equal(t, "orders", delivery.AppId)
+	assert.Equal(t, "TcrTestReplyQueue", delivery.ReplyTo)
+	assert.Equal(t, "60000", delivery.Expiration)
+	assert.Equal(t, "identity", delivery.ContentEncoding)
+
+	TestCleanup(t)
+}
+
+func TestConsumeBatches(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	config := *AckableConsumerConfig
+	config.QosCountOverride = 10
+	config.BatchConfig = &tcr.BatchConfig{Size: 5, Window: 500}
+
+	_, _ = RabbitService.Topologer.PurgeQueue("TcrTestQueue", false)
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	for i := 0; i < 7; i++ {
+		assert.NoError(t, publisher.PublishWithConfirmationError(tcr.CreateMockRandomLetter("TcrTestQueue"), time.Second))
+	}
+
+	batches := make(chan int, 10)
+	consumer := tcr.NewConsumerFromConfig(&config, ConnectionPool)
+	consumer.StartConsumingBatches(func(batch []*tcr.ReceivedMessage) error {
+		batches <- len(batch)
+		return nil
+	})
+
+	// A full batch right away, the rest once the window passes.
+	for _, expected := range []int{5, 2} {
+		select {
+		case size := <-batches:
+			assert.Equal(t, expected, size)
+		case <-time.After(5 * time.Second):
+			t.Fatal("test timeout")
+		}
+	}
+
+	assert.NoError(t, consumer.StopConsuming(false, true))
+
+	delivery, err := consumer.Get("TcrTestQueue")
+	assert.NoError(t, err)
+	assert.Nil(t, delivery) // every batch was acknowledged
+
+	publisher.Shutdown(false)
+	TestCleanup(t)
+}
+
+func TestConsumeBatchesSettlesAroundHeldMessage(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	broker := newFakeBroker(t, nil)
+	broker.DeliverOnConsume(7)
+
+	pool, err := tcr.NewConnectionPool(&tcr.PoolConfig{
+		URI:                  broker.URI(),
+		Heartbeat:            60,
+		ConnectionTimeout:    10,
+		MaxConnectionCount:   1,
+		MaxCacheChannelCount: 2,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	consumer := tcr.NewConsumerFromConfig(&tcr.ConsumerConfig{
+		Enabled:             true,
+		QueueName:           "TcrTestQueue",
+		ConsumerName:        "TurboCookedRabbitConsumer-Batches",
+		SleepOnIdleInterval: 1,
+		BatchConfig:         &tcr.BatchConfig{Size: 3, Window: 60000},
+	}, pool)
+
+	// The first message is held back from the batches until the fifth arrives.
+	var held *tcr.ReceivedMessage
+	consumer.UseMiddleware(func(next tcr.Handler) tcr.Handler {
+		return func(msg *tcr.ReceivedMessage) error {
+			switch msg.Delivery.DeliveryTag {
+			case 1:
+				held = msg
+				return nil
+			case 5:
+				if err := held.Acknowledge(); err != nil {
+					return err
+				}
+			}
+			return next(msg)
+		}
+	})
+
+	consumer.StartConsumingBatches(func(batch []*tcr.ReceivedMessage) error { return nil })
+
+	// The first batch is acked message by message, a multiple ack would have settled the held one too.
+	expected := []fakeSettle{
+		{Method: "ack", DeliveryTag: 2},
+		{Method: "ack", DeliveryTag: 3},
+		{Method: "ack", DeliveryTag: 4},
+		{Method: "ack", DeliveryTag: 1},
+		{Method: "ack", DeliveryTag: 7, Multiple: true},
+	}
+	assert.Eventually(t, func() bool { return len(broker.Settles()) == len(expected) }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, expected, broker.Settles())
+
+	assert.NoError(t, consumer.StopConsuming(false, true))
+	pool.Shutdown()
+	broker.Close()
+}
+
+func TestConsumerGetAckable(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	_, _ = RabbitService.Topologer.PurgeQueue("TcrTestQueue", false)
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, publisher.PublishWithConfirmationError(tcr.CreateMockRandomLetter("TcrTestQueue"), time.Second))
+	}
+
+	consumer := tcr.NewConsumerFromConfig(ConsumerConfig, ConnectionPool)
+
+	messages, release, err := consumer.GetBatchAckable(context.Background(), "TcrTestQueue", 5)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 3)
+	assert.NoError(t, messages[0].Acknowledge())
+	assert.NoError(t, messages[1].Acknowledge())
+	release() // requeues the third
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	msg, release, err := consumer.GetAckable(ctx, "TcrTestQueue")
+	assert.NoError(t, err)
+	assert.NoError(t, msg.Acknowledge())
+	release()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	msg, release, err = consumer.GetAckable(ctx, "TcrTestQueue")
+	assert.Nil(t, msg)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	release()
+
+	publisher.Shutdown(false)
+	TestCleanup(t)
+}
+
+func TestConsumerDeclaresTopology(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	config := *ConsumerConfig
+	config.QueueName = "TcrExclusiveTestQueue"
+	config.Topology = &tcr.TopologyConfig{
+		Queues: []*tcr.Queue{{Name: "TcrExclusiveTestQueue", Exclusive: true, AutoDelete: true}},
+	}
+
+	consumer := tcr.NewConsumerFromConfig(&config, ConnectionPool)
+	consumer.StartConsuming()
+
+	// The queue only exists once the consumer declared it on its own channel, until then letters are returned.
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	assert.Eventually(t, func() bool {
+		letter := tcr.CreateMockRandomLetter("TcrExclusiveTestQueue")
+		letter.Envelope.Mandatory = true
+		return publisher.PublishAsync(context.Background(), letter).Wait() == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	select {
+	case message := <-consumer.ReceivedMessages():
+		_ = message.Acknowledge()
+	case <-time.After(5 * time.Second):
+		t.Fatal("test timeout")
+	}
+
+	assert.NoError(t, consumer.StopConsuming(false, true))
+	publisher.Shutdown(false)
+	TestCleanup(t)
+}
+
+func TestConsumerResubscribesAfterCancel(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	queueName := "TcrCancelTestQueue"
+	assert.NoError(t, RabbitService.Topologer.CreateQueue(queueName, false, false, false, false, false, nil))
+
+	config := *ConsumerConfig
+	config.QueueName = queueName
+	config.SleepOnErrorInterval = 50
+
+	consumer := tcr.NewConsumerFromConfig(&config, ConnectionPool)
+	consumer.StartConsuming()
+
+	// Receiving a letter shows the subscription is up.
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	assert.NoError(t, publisher.PublishWithConfirmationError(tcr.CreateMockRandomLetter(queueName), time.Second))
+
+	select {
+	case <-consumer.ReceivedMessages():
+	case <-time.After(5 * time.Second):
+		t.Fatal("test timeout waiting on the subscription")
+	}
+
+	// Deleting the queue cancels the subscription server side.
+	_, err := RabbitService.Topologer.QueueDelete(queueName, false, false, false)
+	assert.NoError(t, err)
+
+	timeout := time.After(5 * time.Second)
+WaitForCancel:
+	for {
+		select {
+		case err := <-consumer.Errors():
+			if errors.Is(err, tcr.ErrConsumerCanceled) {
+				break WaitForCancel
+			}
+		case <-timeout:
+			t.Fatal("test timeout waiting on the cancellation")
+		}
+	}
+
+	assert.NoError(t, RabbitService.Topologer.CreateQueue(queueName, false, false, false, false, false, nil))
+
+	select {
+	case recovery := <-consumer.Recoveries():
+		assert.Equal(t, queueName, recovery.QueueName)
+	case <-time.After(10 * time.Second):
+		t.Fatal("test timeout waiting on the recovery")
+	}
+
+	assert.NoError(t, consumer.StopConsuming(false, true))
+	_, _ = RabbitService.Topologer.QueueDelete(queueName, false, false, false)
+	publisher.Shutdown(false)
+	TestCleanup(t)
+}
+
+func TestConsumerPauseWhileUnhealthy(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	consumer := tcr.NewConsumerFromConfig(&tcr.ConsumerConfig{ConsumerName: "TcrPauseTest"}, nil)
+
+	consumer.Pause()
+	assert.True(t, consumer.Paused())
+	consumer.Resume()
+	assert.False(t, consumer.Paused())
+
+	var healthy atomic.Value
+	healthy.Store(false)
+	stop := consumer.PauseWhileUnhealthy(func(ctx context.Context) error {
+		if healthy.Load().(bool) {
+			return nil
+		}
+		return errors.New("database degraded")
+	}, 10*time.Millisecond)
+	defer stop()
+
+	assert.Eventually(t, consumer.Paused, time.Second, 5*time.Millisecond)
+	assert.ErrorContains(t, <-consumer.Errors(), "database degraded")
+
+	// Resume doesn't override a failing health check.
+	consumer.Resume()
+	assert.True(t, consumer.Paused())
+
+	healthy.Store(true)
+	assert.Eventually(t, func() bool { return !consumer.Paused() }, time.Second, 5*time.Millisecond)
+
+	// A manual pause outlasts passing health checks.
+	consumer.Pause()
+	assert.Never(t, func() bool { return !consumer.Paused() }, 50*time.Millisecond, 5*time.Millisecond)
+}
+
+func TestConsumerPauseResume(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	_, _ = RabbitService.Topologer.PurgeQueue("TcrTestQueue", false)
+
+	consumer := tcr.NewConsumerFromConfig(AckableConsumerConfig, ConnectionPool)
+	consumer.StartConsuming()
+	consumer.Pause()
+
+	// Letters received before the subscription was canceled are still handed out, wait for one to stay queued.
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	assert.Eventually(t, func() bool {
+		assert.NoError(t, publisher.PublishWithConfirmationError(tcr.CreateMockRandomLetter("TcrTestQueue"), time.Second))
+
+		select {
+		case message := <-consumer.ReceivedMessages():
+			assert.NoError(t, message.Acknowledge())
+			return false
+		case <-time.After(500 * time.Millisecond):
+			return true
+		}
+	}, 10*time.Second, 10*time.Millisecond)
+
+	consumer.Resume()
+
+	select {
+	case message := <-consumer.ReceivedMessages():
+		assert.NoError(t, message.Acknowledge())
+	case <-time.After(5 * time.Second):
+		t.Fatal("test timeout")
+	}
+
+	assert.NoError(t, consumer.StopConsuming(false, true))
+	publisher.Shutdown(false)
+	TestCleanup(t)
+}
+
+func TestConsumerPauseKeepsChannel(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	broker := newFakeBroker(t, nil)
+
+	pool, err := tcr.NewConnectionPool(&tcr.PoolConfig{
+		URI:                  broker.URI(),
+		Heartbeat:            60,
+		ConnectionTimeout:    10,
+		MaxConnectionCount:   1,
+		MaxCacheChannelCount: 2,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	consumer := tcr.NewConsumerFromConfig(&tcr.ConsumerConfig{
+		Enabled:             true,
+		QueueName:           "TcrTestQueue",
+		ConsumerName:        "TurboCookedRabbitConsumer-Pause",
+		SleepOnIdleInterval: 10,
+	}, pool)
+	consumer.StartConsuming()
+	assert.Eventually(t, func() bool { return len(broker.Consumes()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	consumer.Pause()
+	assert.Eventually(t, func() bool { return broker.Cancels() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// Deliveries may still be settled on the consumer's channel, the pool mustn't hand it out while paused.
+	taken := make(chan *tcr.ChannelHost, 2)
+	go func() {
+		taken <- pool.GetChannelFromPool()
+		taken <- pool.GetChannelFromPool() // the consumer's, once it stops
+	}()
+	assert.Never(t, func() bool { return len(taken) == 2 }, 200*time.Millisecond, 10*time.Millisecond)
+
+	// Resuming subscribes on the same channel again.
+	consumer.Resume()
+	assert.Eventually(t, func() bool { return len(broker.Consumes()) == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	consumes := broker.Consumes()
+	if assert.Len(t, consumes, 2) {
+		assert.Equal(t, consumes[0], consumes[1])
+	}
+
+	assert.NoError(t, consumer.StopConsuming(true, true))
+	pool.ReturnChannel(<-taken, false)
+	pool.ReturnChannel(<-taken, false)
+	pool.Shutdown()
+	broker.Close()
+}
+
+func TestConsumerAdaptivePrefetchBounds(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	config := *AckableConsumerConfig
+	config.QosCountOverride = 100
+	config.AdaptiveQosConfig = &tcr.AdaptiveQosConfig{Enabled: true, MinPrefetch: 2, MaxPrefetch: 20}
+
+	consumer := tcr.NewConsumerFromConfig(&config, nil)
+	assert.Equal(t, 20, consumer.Prefetch())
+
+	consumer.UseAdaptiveQos(nil)
+	assert.Equal(t, 100, consumer.Prefetch())
+}
+
+func TestConsumerAdaptivePrefetch(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	_, _ = RabbitService.Topologer.PurgeQueue("TcrTestQueue", false)
+
+	config := *AckableConsumerConfig
+	config.QosCountOverride = 8
+	config.AdaptiveQosConfig = &tcr.AdaptiveQosConfig{Enabled: true, MinPrefetch: 1, MaxPrefetch: 8, TargetLatency: 10, AdjustInterval: 200}
+
+	consumer := tcr.NewConsumerFromConfig(&config, ConnectionPool)
+	consumer.StartConsumingWithAction(func(msg *tcr.ReceivedMessage) {
+		time.Sleep(50 * time.Millisecond) // slower than the target latency
+		_ = msg.Acknowledge()
+	})
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, publisher.PublishWithConfirmationError(tcr.CreateMockRandomLetter("TcrTestQueue"), time.Second))
+	}
+
+	assert.Eventually(t, func() bool { return consumer.Prefetch() < 8 }, 5*time.Second, 50*time.Millisecond)
+
+	assert.NoError(t, consumer.StopConsuming(false, true))
+	publisher.Shutdown(false)
+	TestCleanup(t)
+}
@@ -0,0 +1,119 @@
+package main_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tiggerite/turbocookedrabbit/v2/pkg/tcr"
+)
+
+func TestEnvCredentialsProvider(t *testing.T) {
+
+	provider := tcr.EnvCredentialsProvider("TCR_TEST_USERNAME", "TCR_TEST_PASSWORD")
+
+	_, err := provider()
+	assert.Error(t, err)
+
+	os.Setenv("TCR_TEST_USERNAME", "guest")
+	os.Setenv("TCR_TEST_PASSWORD", "guest")
+	defer os.Unsetenv("TCR_TEST_USERNAME")
+	defer os.Unsetenv("TCR_TEST_PASSWORD")
+
+	credentials, err := provider()
+	assert.NoError(t, err)
+	assert.Equal(t, "guest", credentials.Username)
+	assert.Equal(t, "guest", credentials.Password)
+	assert.True(t, credentials.Expiration.IsZero())
+}
+
+func TestFileCredentialsProvider(t *testing.T) {
+
+	dir := t.TempDir()
+	usernameLocation := filepath.Join(dir, "username")
+	passwordLocation := filepath.Join(dir, "password")
+
+	provider := tcr.FileCredentialsProvider(usernameLocation, passwordLocation)
+
+	_, err := provider()
+	assert.Error(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(usernameLocation, []byte("guest\n"), 0600))
+	assert.NoError(t, ioutil.WriteFile(passwordLocation, []byte("rotated-password\n"), 0600))
+
+	credentials, err := provider()
+	assert.NoError(t, err)
+	assert.Equal(t, "guest", credentials.Username)
+	assert.Equal(t, "rotated-password", credentials.Password)
+}
+
+func TestCredentialsRotationOnRedial(t *testing.T) {
+
+	broker := newFakeBroker(t, nil)
+
+	password := "first-password"
+	passwordLock := &sync.Mutex{}
+	provider := func() (*tcr.Credentials, error) {
+		passwordLock.Lock()
+		defer passwordLock.Unlock()
+		return &tcr.Credentials{Username: "tcr", Password: password}, nil
+	}
+
+	connHost, err := tcr.NewConnectionHostFromConfig(&tcr.PoolConfig{
+		URI:                 broker.URI(),
+		Heartbeat:           60,
+		ConnectionTimeout:   10,
+		CredentialsProvider: provider,
+	}, "tcr-credentials", 0)
+	assert.NoError(t, err)
+
+	handshake := broker.NextHandshake(t, 5*time.Second)
+	assert.Equal(t, "tcr", handshake.Username)
+	assert.Equal(t, "first-password", handshake.Password)
+
+	passwordLock.Lock()
+	password = "rotated-password"
+	passwordLock.Unlock()
+
+	assert.NoError(t, connHost.Connection.Close())
+	assert.True(t, connHost.Connect())
+	assert.Equal(t, "rotated-password", broker.NextHandshake(t, 5*time.Second).Password)
+	assert.NoError(t, connHost.Connection.Close())
+}
+
+func TestCredentialsRefreshedBeforeExpiration(t *testing.T) {
+
+	broker := newFakeBroker(t, nil)
+
+	var calls int32
+	provider := func() (*tcr.Credentials, error) {
+		call := atomic.AddInt32(&calls, 1)
+		credentials := &tcr.Credentials{Username: "tcr", Password: fmt.Sprintf("password-%d", call)}
+		if call == 1 {
+			credentials.Expiration = time.Now().Add(5 * time.Second) // within the refresh window
+		}
+		return credentials, nil
+	}
+
+	pool, err := tcr.NewConnectionPool(&tcr.PoolConfig{
+		URI:                      broker.URI(),
+		Heartbeat:                60,
+		ConnectionTimeout:        10,
+		MaxConnectionCount:       1,
+		MaxCacheChannelCount:     1,
+		CredentialsRefreshWindow: 60,
+		CredentialsProvider:      provider,
+	})
+	assert.NoError(t, err)
+	defer pool.Shutdown()
+
+	assert.Equal(t, "password-1", broker.NextHandshake(t, 5*time.Second).Password)
+	assert.Equal(t, "password-2", broker.NextHandshake(t, 5*time.Second).Password)
+	assert.Eventually(t, func() bool { return pool.Stats().ConnectionsOpen == 1 }, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,211 @@
+package main_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/tiggerite/turbocookedrabbit/v2/pkg/tcr"
+)
+
+// countingAcknowledger counts acks without a channel.
+type countingAcknowledger struct {
+	acks int
+}
+
+func (ack *countingAcknowledger) Ack(tag uint64, multiple bool) error {
+	ack.acks++
+	return nil
+}
+
+func (ack *countingAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error { return nil }
+
+func (ack *countingAcknowledger) Reject(tag uint64, requeue bool) error { return nil }
+
+func TestMemoryDedupStore(t *testing.T) {
+
+	store := tcr.NewMemoryDedupStore(2, time.Hour)
+	assert.NoError(t, store.Mark("a"))
+	assert.NoError(t, store.Mark("b"))
+	assert.NoError(t, store.Mark("c")) // evicts a
+
+	seen, _ := store.Seen("a")
+	assert.False(t, seen)
+	seen, _ = store.Seen("c")
+	assert.True(t, seen)
+	assert.Equal(t, 2, store.Len())
+
+	expiring := tcr.NewMemoryDedupStore(10, time.Millisecond)
+	assert.NoError(t, expiring.Mark("a"))
+	assert.Eventually(t, func() bool {
+		seen, _ := expiring.Seen("a")
+		return !seen
+	}, time.Second, time.Millisecond)
+}
+
+func TestFileDedupStore(t *testing.T) {
+
+	directory := t.TempDir()
+
+	store, err := tcr.NewFileDedupStore(directory, 0, time.Hour)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Mark("order-1"))
+	assert.Error(t, store.Mark("order\n2"))
+	assert.NoError(t, store.Close())
+
+	store, err = tcr.NewFileDedupStore(directory, 0, time.Hour)
+	assert.NoError(t, err)
+	defer store.Close()
+
+	seen, err := store.Seen("order-1")
+	assert.NoError(t, err)
+	assert.True(t, seen)
+
+	seen, _ = store.Seen("order-2")
+	assert.False(t, seen)
+}
+
+func TestFileDedupStoreCapacity(t *testing.T) {
+
+	directory := t.TempDir()
+
+	store, err := tcr.NewFileDedupStore(directory, 2, time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, store.Mark(fmt.Sprintf("order-%d", i)))
+	}
+
+	seen, _ := store.Seen("order-7")
+	assert.False(t, seen)
+	seen, _ = store.Seen("order-9")
+	assert.True(t, seen)
+
+	// The log is compacted as it grows past twice the capacity.
+	log, err := os.ReadFile(filepath.Join(directory, "dedup.log"))
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, strings.Count(string(log), "\n"), 4)
+	assert.NoError(t, store.Close())
+
+	store, err = tcr.NewFileDedupStore(directory, 2, time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer store.Close()
+
+	seen, _ = store.Seen("order-8")
+	assert.True(t, seen)
+	seen, _ = store.Seen("order-9")
+	assert.True(t, seen)
+	seen, _ = store.Seen("order-7")
+	assert.False(t, seen)
+}
+
+func TestConsumerUseDedup(t *testing.T) {
+
+	consumer := tcr.NewConsumerFromConfig(&tcr.ConsumerConfig{ConsumerName: "TurboCookedRabbitConsumer-Dedup"}, nil)
+
+	assert.NoError(t, consumer.UseDedup(nil))
+	assert.NoError(t, consumer.UseDedup(&tcr.DedupConfig{Directory: string([]byte{0})})) // disabled, never opened
+	assert.NoError(t, consumer.UseDedup(&tcr.DedupConfig{Enabled: true, Header: "x-order-id"}))
+
+	// A directory that can't be created fails.
+	file := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(file, nil, 0600))
+	assert.Error(t, consumer.UseDedup(&tcr.DedupConfig{Enabled: true, Directory: filepath.Join(file, "dedup")}))
+}
+
+func TestIdempotent(t *testing.T) {
+
+	store, err := tcr.NewDedupStore(&tcr.DedupConfig{})
+	assert.NoError(t, err)
+
+	handled := 0
+	acknowledge := true
+	action := tcr.Idempotent(store, "")(func(msg *tcr.ReceivedMessage) error {
+		handled++
+		if acknowledge {
+			return msg.Acknowledge()
+		}
+		return nil
+	})
+
+	acknowledger := &countingAcknowledger{}
+	delivery := amqp.Delivery{MessageId: "order-1", Acknowledger: acknowledger}
+
+	assert.NoError(t, action(tcr.NewReceivedMessage(true, delivery)))
+	assert.NoError(t, action(tcr.NewReceivedMessage(true, delivery))) // duplicate, acked without the handler
+	assert.Equal(t, 1, handled)
+	assert.Equal(t, 2, acknowledger.acks)
+
+	// Messages the handler didn't acknowledge aren't recorded.
+	acknowledge = false
+	delivery.MessageId = "order-2"
+	_ = action(tcr.NewReceivedMessage(true, delivery))
+	_ = action(tcr.NewReceivedMessage(true, delivery))
+	assert.Equal(t, 3, handled)
+
+	// Messages the handler failed aren't recorded either.
+	delivery.MessageId = "order-4"
+	failing := tcr.Idempotent(store, "")(func(msg *tcr.ReceivedMessage) error {
+		handled++
+		_ = msg.Acknowledge()
+		return errors.New("downstream failed")
+	})
+	assert.Error(t, failing(tcr.NewReceivedMessage(true, delivery)))
+	assert.Error(t, failing(tcr.NewReceivedMessage(true, delivery)))
+	assert.Equal(t, 5, handled)
+
+	// IDs can come from a header instead.
+	headerAction := tcr.Idempotent(store, "x-order-id")(func(msg *tcr.ReceivedMessage) error {
+		handled++
+		return nil
+	})
+	headerDelivery := amqp.Delivery{Headers: amqp.Table{"x-order-id": "order-3"}}
+	_ = headerAction(tcr.NewReceivedMessage(false, headerDelivery))
+	_ = headerAction(tcr.NewReceivedMessage(false, headerDelivery))
+	assert.Equal(t, 6, handled)
+}
+
+func TestIdempotentMarksWhenAcknowledgedLater(t *testing.T) {
+
+	store, err := tcr.NewDedupStore(&tcr.DedupConfig{})
+	assert.NoError(t, err)
+
+	// Like consuming without an action, messages are handed out and acknowledged by their reader.
+	received := make(chan *tcr.ReceivedMessage, 3)
+	action := tcr.Idempotent(store, "")(func(msg *tcr.ReceivedMessage) error {
+		received <- msg
+		return nil
+	})
+
+	acknowledger := &countingAcknowledger{}
+	delivery := amqp.Delivery{MessageId: "order-1", Acknowledger: acknowledger}
+
+	assert.NoError(t, action(tcr.NewReceivedMessage(true, delivery)))
+
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		assert.NoError(t, (<-received).Acknowledge())
+	}()
+	<-read
+
+	assert.NoError(t, action(tcr.NewReceivedMessage(true, delivery))) // duplicate, acked without handing it out
+	assert.Len(t, received, 0)
+	assert.Equal(t, 2, acknowledger.acks)
+
+	// A message handed out but not yet acknowledged isn't recorded.
+	delivery.MessageId = "order-2"
+	assert.NoError(t, action(tcr.NewReceivedMessage(true, delivery)))
+	assert.NoError(t, action(tcr.NewReceivedMessage(true, delivery)))
+	assert.Len(t, received, 2)
+}
@@ -0,0 +1,533 @@
+package main_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeHandshake is what a client presented while connecting to the fakeBroker.
+type fakeHandshake struct {
+	Username         string
+	Password         string
+	ClientProperties []byte // raw AMQP field table
+	PeerCertificate  *x509.Certificate
+}
+
+// fakeBroker speaks just enough AMQP 0-9-1 to open connections, channels, confirm mode and consumers that never
+// receive anything, to check what clients send without a RabbitMQ server. Publishes are counted but never confirmed, unless ConfirmPublishes is called.
+type fakeBroker struct {
+	listener        net.Listener
+	handshakes      chan *fakeHandshake
+	publishes       int32    // basic.publish received
+	confirms        int32    // 1 to ack publishes on confirm channels
+	returnMandatory int32    // 1 to return mandatory publishes as unroutable
+	consumes        []uint16 // channel of every basic.consume
+	cancels         int32    // basic.cancel received
+	channelCloses   int32    // channel.close received
+	deliveries      int32    // messages delivered to every basic.consume
+	settles         []fakeSettle
+	conns           []net.Conn
+	connsLock       *sync.Mutex
+}
+
+// fakeSettle is a basic.ack, basic.nack or basic.reject received by the fakeBroker.
+type fakeSettle struct {
+	Method      string
+	DeliveryTag uint64
+	Multiple    bool
+}
+
+// fakePublish is a publish being received by the fakeBroker, its method, content header and body frames.
+type fakePublish struct {
+	method    []byte
+	mandatory bool
+	header    []byte
+	bodySize  uint64
+	received  uint64
+	bodies    [][]byte
+}
+
+// fakeChannel is the confirm mode of a channel opened on the fakeBroker.
+type fakeChannel struct {
+	confirming  bool
+	deliveryTag uint64
+	publish     *fakePublish
+}
+
+// newFakeBroker listens on a random local port, over TLS requesting a client certificate when tlsConfig isn't nil.
+func newFakeBroker(t *testing.T, tlsConfig *tls.Config) *fakeBroker {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	broker := &fakeBroker{
+		listener:   listener,
+		handshakes: make(chan *fakeHandshake, 100),
+		connsLock:  &sync.Mutex{},
+	}
+
+	go broker.accept()
+	t.Cleanup(broker.Close)
+
+	return broker
+}
+
+// URI returns the AMQP URI of the fakeBroker.
+func (broker *fakeBroker) URI() string {
+	return "amqp://guest:guest@" + broker.listener.Addr().String() + "/"
+}
+
+// Close stops listening and drops every connection.
+func (broker *fakeBroker) Close() {
+	broker.listener.Close()
+
+	broker.connsLock.Lock()
+	defer broker.connsLock.Unlock()
+
+	for _, conn := range broker.conns {
+		conn.Close()
+	}
+}
+
+// ConfirmPublishes has the fakeBroker ack every publish on channels in confirm mode.
+func (broker *fakeBroker) ConfirmPublishes() {
+	atomic.StoreInt32(&broker.confirms, 1)
+}
+
+// ReturnMandatory has the fakeBroker return every mandatory publish as unroutable, ahead of its confirmation.
+func (broker *fakeBroker) ReturnMandatory() {
+	atomic.StoreInt32(&broker.returnMandatory, 1)
+}
+
+// DeliverOnConsume has the fakeBroker deliver count messages to every consumer once subscribed.
+func (broker *fakeBroker) DeliverOnConsume(count int) {
+	atomic.StoreInt32(&broker.deliveries, int32(count))
+}
+
+// Publishes returns the count of basic.publish received.
+func (broker *fakeBroker) Publishes() int {
+	return int(atomic.LoadInt32(&broker.publishes))
+}
+
+// Consumes returns the channel of every basic.consume received, in order.
+func (broker *fakeBroker) Consumes() []uint16 {
+	broker.connsLock.Lock()
+	defer broker.connsLock.Unlock()
+
+	return append([]uint16{}, broker.consumes...)
+}
+
+// Settles returns every basic.ack, basic.nack and basic.reject received, in order.
+func (broker *fakeBroker) Settles() []fakeSettle {
+	broker.connsLock.Lock()
+	defer broker.connsLock.Unlock()
+
+	return append([]fakeSettle{}, broker.settles...)
+}
+
+// ChannelCloses returns the count of channel.close received.
+func (broker *fakeBroker) ChannelCloses() int {
+	return int(atomic.LoadInt32(&broker.channelCloses))
+}
+
+// Cancels returns the count of basic.cancel received.
+func (broker *fakeBroker) Cancels() int {
+	return int(atomic.LoadInt32(&broker.cancels))
+}
+
+// NextHandshake waits for the next client to complete the AMQP handshake.
+func (broker *fakeBroker) NextHandshake(t *testing.T, timeout time.Duration) *fakeHandshake {
+
+	select {
+	case handshake := <-broker.handshakes:
+		return handshake
+	case <-time.After(timeout):
+		t.Fatal("no handshake with the fake broker in time")
+		return nil
+	}
+}
+
+func (broker *fakeBroker) accept() {
+	for {
+		conn, err := broker.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		broker.connsLock.Lock()
+		broker.conns = append(broker.conns, conn)
+		broker.connsLock.Unlock()
+
+		go broker.serve(conn)
+	}
+}
+
+func (broker *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+
+	handshake := &fakeHandshake{}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		if peers := tlsConn.ConnectionState().PeerCertificates; len(peers) > 0 {
+			handshake.PeerCertificate = peers[0]
+		}
+	}
+
+	reader := bufio.NewReader(conn)
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(reader, header); err != nil || string(header[:4]) != "AMQP" {
+		return
+	}
+
+	// connection.start: version 0-9, no server properties, mechanisms, locales
+	start := &bytes.Buffer{}
+	start.Write([]byte{0, 9})
+	writeLong(start, 0)
+	writeLongString(start, "PLAIN EXTERNAL")
+	writeLongString(start, "en_US")
+	writeMethod(conn, 0, 10, 10, start.Bytes())
+
+	channels := make(map[uint16]*fakeChannel)
+	for {
+		frameType, channel, payload, err := readFrame(reader)
+		if err != nil {
+			return
+		}
+
+		if state, ok := channels[channel]; ok && state.publish != nil && (frameType == 2 || frameType == 3) {
+			if state.publish.receive(frameType, payload) {
+				broker.completePublish(conn, channel, state)
+			}
+			continue
+		}
+
+		if frameType != 1 || len(payload) < 4 { // only methods are answered, heartbeats are ignored
+			continue
+		}
+
+		classID := binary.BigEndian.Uint16(payload[0:2])
+		methodID := binary.BigEndian.Uint16(payload[2:4])
+		args := payload[4:]
+
+		switch {
+		case classID == 10 && methodID == 11: // connection.start-ok
+			parseStartOk(args, handshake)
+			tune := &bytes.Buffer{}
+			_ = binary.Write(tune, binary.BigEndian, uint16(2047))
+			writeLong(tune, 131072)
+			_ = binary.Write(tune, binary.BigEndian, uint16(0))
+			writeMethod(conn, 0, 10, 30, tune.Bytes())
+
+		case classID == 10 && methodID == 40: // connection.open
+			writeMethod(conn, 0, 10, 41, []byte{0})
+			broker.handshakes <- handshake
+
+		case classID == 10 && methodID == 50: // connection.close
+			writeMethod(conn, 0, 10, 51, nil)
+			return
+
+		case classID == 20 && methodID == 10: // channel.open
+			channels[channel] = &fakeChannel{}
+			writeMethod(conn, channel, 20, 11, []byte{0, 0, 0, 0})
+
+		case classID == 20 && methodID == 40: // channel.close
+			atomic.AddInt32(&broker.channelCloses, 1)
+			delete(channels, channel)
+			writeMethod(conn, channel, 20, 41, nil)
+
+		case classID == 85 && methodID == 10: // confirm.select
+			if state, ok := channels[channel]; ok {
+				state.confirming = true
+			}
+			writeMethod(conn, channel, 85, 11, nil)
+
+		case classID == 60 && methodID == 10: // basic.qos
+			writeMethod(conn, channel, 60, 11, nil)
+
+		case classID == 60 && methodID == 20: // basic.consume, nothing is delivered unless DeliverOnConsume was called
+			tag := []byte{0}
+			if offset := 2; offset < len(args) {
+				offset += 1 + int(args[offset]) // queue
+				if offset < len(args) && offset+1+int(args[offset]) <= len(args) {
+					tag = args[offset : offset+1+int(args[offset])]
+				}
+			}
+			broker.connsLock.Lock()
+			broker.consumes = append(broker.consumes, channel)
+			broker.connsLock.Unlock()
+			writeMethod(conn, channel, 60, 21, tag)
+			broker.deliver(conn, channel, tag)
+
+		case classID == 60 && methodID == 30: // basic.cancel
+			atomic.AddInt32(&broker.cancels, 1)
+			tag := []byte{0}
+			if len(args) > 0 && 1+int(args[0]) <= len(args) {
+				tag = args[:1+int(args[0])]
+			}
+			writeMethod(conn, channel, 60, 31, tag)
+
+		case classID == 60 && (methodID == 80 || methodID == 90 || methodID == 120) && len(args) >= 9: // basic.ack, reject and nack
+			settle := fakeSettle{
+				Method:      map[uint16]string{80: "ack", 90: "reject", 120: "nack"}[methodID],
+				DeliveryTag: binary.BigEndian.Uint64(args[0:8]),
+				Multiple:    methodID != 90 && args[8]&1 == 1,
+			}
+			broker.connsLock.Lock()
+			broker.settles = append(broker.settles, settle)
+			broker.connsLock.Unlock()
+
+		case classID == 60 && methodID == 40: // basic.publish, its content frames follow
+			atomic.AddInt32(&broker.publishes, 1)
+			if state, ok := channels[channel]; ok {
+				state.publish = newFakePublish(args)
+			}
+		}
+	}
+}
+
+// newFakePublish reads the mandatory flag from the basic.publish arguments.
+func newFakePublish(args []byte) *fakePublish {
+
+	publish := &fakePublish{method: args}
+
+	// reserved short, exchange and routing key short strings, then the mandatory and immediate bits
+	offset := 2
+	for i := 0; i < 2 && offset < len(args); i++ {
+		offset += 1 + int(args[offset])
+	}
+	if offset < len(args) {
+		publish.mandatory = args[offset]&1 == 1
+	}
+
+	return publish
+}
+
+// receive adds a content header or body frame, returning true once the whole body was received.
+func (publish *fakePublish) receive(frameType byte, payload []byte) bool {
+
+	if frameType == 2 {
+		publish.header = payload
+		if len(payload) >= 12 {
+			publish.bodySize = binary.BigEndian.Uint64(payload[4:12])
+		}
+	} else {
+		publish.bodies = append(publish.bodies, payload)
+		publish.received += uint64(len(payload))
+	}
+
+	return publish.header != nil && publish.received >= publish.bodySize
+}
+
+// completePublish returns the publish when mandatory and configured to, then confirms it when in confirm mode.
+func (broker *fakeBroker) completePublish(conn net.Conn, channel uint16, state *fakeChannel) {
+
+	publish := state.publish
+	state.publish = nil
+
+	if publish.mandatory && atomic.LoadInt32(&broker.returnMandatory) == 1 {
+		// basic.return: reply code, reply text, then the exchange and routing key as published
+		returned := &bytes.Buffer{}
+		_ = binary.Write(returned, binary.BigEndian, uint16(312))
+		returned.WriteByte(byte(len("NO_ROUTE")))
+		returned.WriteString("NO_ROUTE")
+		returned.Write(publish.method[2:])
+		returned.Truncate(returned.Len() - 1) // without the mandatory and immediate bits
+
+		writeMethod(conn, channel, 60, 50, returned.Bytes())
+		writeFrame(conn, 2, channel, publish.header)
+		for _, body := range publish.bodies {
+			writeFrame(conn, 3, channel, body)
+		}
+	}
+
+	if !state.confirming {
+		return
+	}
+
+	state.deliveryTag++
+	if atomic.LoadInt32(&broker.confirms) == 1 {
+		ack := &bytes.Buffer{}
+		_ = binary.Write(ack, binary.BigEndian, state.deliveryTag)
+		ack.WriteByte(0)
+		writeMethod(conn, channel, 60, 80, ack.Bytes())
+	}
+}
+
+// deliver sends the DeliverOnConsume count of messages to the consumer tag, without properties.
+func (broker *fakeBroker) deliver(conn net.Conn, channel uint16, tag []byte) {
+
+	body := []byte("fake")
+	for i := 1; i <= int(atomic.LoadInt32(&broker.deliveries)); i++ {
+		// basic.deliver: consumer tag, delivery tag, redelivered, exchange and routing key
+		deliver := &bytes.Buffer{}
+		deliver.Write(tag)
+		_ = binary.Write(deliver, binary.BigEndian, uint64(i))
+		deliver.Write([]byte{0, 0, 0})
+		writeMethod(conn, channel, 60, 60, deliver.Bytes())
+
+		// content header: class, weight, body size and no property flags
+		header := &bytes.Buffer{}
+		_ = binary.Write(header, binary.BigEndian, uint16(60))
+		_ = binary.Write(header, binary.BigEndian, uint16(0))
+		_ = binary.Write(header, binary.BigEndian, uint64(len(body)))
+		_ = binary.Write(header, binary.BigEndian, uint16(0))
+		writeFrame(conn, 2, channel, header.Bytes())
+		writeFrame(conn, 3, channel, body)
+	}
+}
+
+// parseStartOk reads the client properties and PLAIN credentials of a connection.start-ok.
+func parseStartOk(args []byte, handshake *fakeHandshake) {
+
+	if len(args) < 4 {
+		return
+	}
+
+	tableLength := binary.BigEndian.Uint32(args[0:4])
+	if int(4+tableLength) > len(args) {
+		return
+	}
+	handshake.ClientProperties = append([]byte{}, args[4:4+tableLength]...)
+	rest := args[4+tableLength:]
+
+	if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+		return
+	}
+	rest = rest[1+int(rest[0]):] // mechanism
+
+	if len(rest) < 4 {
+		return
+	}
+	responseLength := binary.BigEndian.Uint32(rest[0:4])
+	if int(4+responseLength) > len(rest) {
+		return
+	}
+
+	// PLAIN responses are "\x00username\x00password".
+	if parts := strings.Split(string(rest[4:4+responseLength]), "\x00"); len(parts) == 3 {
+		handshake.Username = parts[1]
+		handshake.Password = parts[2]
+	}
+}
+
+func readFrame(reader *bufio.Reader) (byte, uint16, []byte, error) {
+
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return 0, 0, nil, err
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint32(header[3:7])+1) // with the frame end
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return 0, 0, nil, err
+	}
+
+	return header[0], binary.BigEndian.Uint16(header[1:3]), payload[:len(payload)-1], nil
+}
+
+func writeMethod(conn net.Conn, channel uint16, classID uint16, methodID uint16, args []byte) {
+
+	payload := &bytes.Buffer{}
+	_ = binary.Write(payload, binary.BigEndian, classID)
+	_ = binary.Write(payload, binary.BigEndian, methodID)
+	payload.Write(args)
+
+	writeFrame(conn, 1, channel, payload.Bytes())
+}
+
+func writeFrame(conn net.Conn, frameType byte, channel uint16, payload []byte) {
+
+	frame := &bytes.Buffer{}
+	frame.WriteByte(frameType)
+	_ = binary.Write(frame, binary.BigEndian, channel)
+	writeLong(frame, uint32(len(payload)))
+	frame.Write(payload)
+	frame.WriteByte(0xCE)
+
+	_, _ = conn.Write(frame.Bytes())
+}
+
+func writeLong(buffer *bytes.Buffer, value uint32) {
+	_ = binary.Write(buffer, binary.BigEndian, value)
+}
+
+func writeLongString(buffer *bytes.Buffer, value string) {
+	writeLong(buffer, uint32(len(value)))
+	buffer.WriteString(value)
+}
+
+// writeTestCertificate writes a new self signed certificate and key as PEM files, returning the certificate.
+func writeTestCertificate(t *testing.T, certLocation string, keyLocation string, commonName string) *x509.Certificate {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := ioutil.WriteFile(certLocation, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyLocation, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
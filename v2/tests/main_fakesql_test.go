@@ -0,0 +1,278 @@
+package main_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeOutboxRow is a row of the outbox table kept by the fakeOutboxDatabase.
+type fakeOutboxRow struct {
+	LetterID  string
+	Letter    string
+	CreatedAt time.Time
+	SentAt    *time.Time
+}
+
+// fakeOutboxDatabase is a database/sql driver understanding only the statements of the SQLOutboxStore, to run its
+// SQL without a database server. Writes in a transaction are only visible to other connections once committed.
+type fakeOutboxDatabase struct {
+	table       string
+	placeholder string // "?" or "$"
+	created     bool
+	rows        []*fakeOutboxRow
+	dbLock      *sync.Mutex
+}
+
+var fakeSQLPlaceholders = regexp.MustCompile(`\?|\$[0-9]+`)
+
+// newFakeOutboxDB opens a *sql.DB on a new fakeOutboxDatabase, expecting the table and placeholder style.
+func newFakeOutboxDB(table string, placeholder string) (*sql.DB, *fakeOutboxDatabase) {
+
+	database := &fakeOutboxDatabase{
+		table:       table,
+		placeholder: placeholder,
+		dbLock:      &sync.Mutex{},
+	}
+
+	return sql.OpenDB(database), database
+}
+
+// Rows returns a copy of the committed rows.
+func (database *fakeOutboxDatabase) Rows() []fakeOutboxRow {
+	database.dbLock.Lock()
+	defer database.dbLock.Unlock()
+
+	rows := make([]fakeOutboxRow, 0, len(database.rows))
+	for _, row := range database.rows {
+		rows = append(rows, *row)
+	}
+
+	return rows
+}
+
+// Connect implements driver.Connector.
+func (database *fakeOutboxDatabase) Connect(context.Context) (driver.Conn, error) {
+	return &fakeOutboxConn{database: database}, nil
+}
+
+// Driver implements driver.Connector.
+func (database *fakeOutboxDatabase) Driver() driver.Driver {
+	return fakeOutboxDriver{}
+}
+
+type fakeOutboxDriver struct{}
+
+func (fakeOutboxDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("open the fake outbox database with newFakeOutboxDB")
+}
+
+// fakeOutboxConn stages the inserts of its open transaction until it commits.
+type fakeOutboxConn struct {
+	database *fakeOutboxDatabase
+	inTx     bool
+	staged   []*fakeOutboxRow
+}
+
+func (conn *fakeOutboxConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("the fake outbox database doesn't prepare statements")
+}
+
+func (conn *fakeOutboxConn) Close() error {
+	return nil
+}
+
+func (conn *fakeOutboxConn) Begin() (driver.Tx, error) {
+
+	if conn.inTx {
+		return nil, errors.New("transaction already open")
+	}
+
+	conn.inTx = true
+	return conn, nil
+}
+
+// Commit implements driver.Tx, making the staged inserts visible.
+func (conn *fakeOutboxConn) Commit() error {
+
+	conn.database.dbLock.Lock()
+	conn.database.rows = append(conn.database.rows, conn.staged...)
+	conn.database.dbLock.Unlock()
+
+	conn.inTx = false
+	conn.staged = nil
+	return nil
+}
+
+// Rollback implements driver.Tx, discarding the staged inserts.
+func (conn *fakeOutboxConn) Rollback() error {
+	conn.inTx = false
+	conn.staged = nil
+	return nil
+}
+
+func (conn *fakeOutboxConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+
+	database := conn.database
+	if err := database.checkPlaceholders(query, args); err != nil {
+		return nil, err
+	}
+
+	database.dbLock.Lock()
+	defer database.dbLock.Unlock()
+
+	if strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS "+database.table+" (") {
+		database.created = true
+		return driver.RowsAffected(0), nil
+	}
+
+	if !database.created {
+		return nil, fmt.Errorf("no such table: %s", database.table)
+	}
+
+	switch {
+	case strings.HasPrefix(query, "INSERT INTO "+database.table+" (letter_id, letter, created_at) VALUES "):
+		row := &fakeOutboxRow{
+			LetterID:  args[0].Value.(string),
+			Letter:    args[1].Value.(string),
+			CreatedAt: args[2].Value.(time.Time),
+		}
+		for _, existing := range append(database.rows, conn.staged...) {
+			if existing.LetterID == row.LetterID {
+				return nil, fmt.Errorf("duplicate letter_id %s", row.LetterID)
+			}
+		}
+
+		if conn.inTx {
+			conn.staged = append(conn.staged, row)
+		} else {
+			database.rows = append(database.rows, row)
+		}
+		return driver.RowsAffected(1), nil
+
+	case strings.HasPrefix(query, "UPDATE "+database.table+" SET sent_at = "):
+		sentAt := args[0].Value.(time.Time)
+		for _, row := range database.rows {
+			if row.LetterID == args[1].Value.(string) {
+				row.SentAt = &sentAt
+				return driver.RowsAffected(1), nil
+			}
+		}
+		return driver.RowsAffected(0), nil
+
+	case strings.HasPrefix(query, "DELETE FROM "+database.table+" WHERE sent_at IS NOT NULL AND sent_at < "):
+		before := args[0].Value.(time.Time)
+		kept := make([]*fakeOutboxRow, 0, len(database.rows))
+		for _, row := range database.rows {
+			if row.SentAt == nil || !row.SentAt.Before(before) {
+				kept = append(kept, row)
+			}
+		}
+		deleted := int64(len(database.rows) - len(kept))
+		database.rows = kept
+		return driver.RowsAffected(deleted), nil
+	}
+
+	return nil, fmt.Errorf("unexpected statement: %s", query)
+}
+
+func (conn *fakeOutboxConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+
+	database := conn.database
+	if err := database.checkPlaceholders(query, args); err != nil {
+		return nil, err
+	}
+
+	database.dbLock.Lock()
+	defer database.dbLock.Unlock()
+
+	if !database.created {
+		return nil, fmt.Errorf("no such table: %s", database.table)
+	}
+
+	var limit int
+	prefix := "SELECT letter FROM " + database.table + " WHERE sent_at IS NULL ORDER BY created_at, letter_id LIMIT "
+	if !strings.HasPrefix(query, prefix) {
+		return nil, fmt.Errorf("unexpected query: %s", query)
+	}
+	if _, err := fmt.Sscanf(query[len(prefix):], "%d", &limit); err != nil {
+		return nil, err
+	}
+
+	unsent := make([]*fakeOutboxRow, 0)
+	for _, row := range database.rows {
+		if row.SentAt == nil {
+			unsent = append(unsent, row)
+		}
+	}
+
+	sort.SliceStable(unsent, func(i, j int) bool {
+		if !unsent[i].CreatedAt.Equal(unsent[j].CreatedAt) {
+			return unsent[i].CreatedAt.Before(unsent[j].CreatedAt)
+		}
+		return unsent[i].LetterID < unsent[j].LetterID
+	})
+
+	if len(unsent) > limit {
+		unsent = unsent[:limit]
+	}
+
+	letters := make([]string, 0, len(unsent))
+	for _, row := range unsent {
+		letters = append(letters, row.Letter)
+	}
+
+	return &fakeOutboxRows{letters: letters}, nil
+}
+
+// checkPlaceholders fails statements not using the expected placeholder style for every argument.
+func (database *fakeOutboxDatabase) checkPlaceholders(query string, args []driver.NamedValue) error {
+
+	placeholders := fakeSQLPlaceholders.FindAllString(query, -1)
+	if len(placeholders) != len(args) {
+		return fmt.Errorf("%d placeholders for %d arguments: %s", len(placeholders), len(args), query)
+	}
+
+	for i, placeholder := range placeholders {
+		expected := "?"
+		if database.placeholder == "$" {
+			expected = fmt.Sprintf("$%d", i+1)
+		}
+		if placeholder != expected {
+			return fmt.Errorf("unexpected placeholder %s: %s", placeholder, query)
+		}
+	}
+
+	return nil
+}
+
+type fakeOutboxRows struct {
+	letters []string
+}
+
+func (rows *fakeOutboxRows) Columns() []string {
+	return []string{"letter"}
+}
+
+func (rows *fakeOutboxRows) Close() error {
+	return nil
+}
+
+func (rows *fakeOutboxRows) Next(dest []driver.Value) error {
+
+	if len(rows.letters) == 0 {
+		return io.EOF
+	}
+
+	dest[0] = rows.letters[0]
+	rows.letters = rows.letters[1:]
+	return nil
+}
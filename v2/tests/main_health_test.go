@@ -0,0 +1,43 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tiggerite/turbocookedrabbit/v2/pkg/tcr"
+)
+
+func TestConnectionPoolHealth(t *testing.T) {
+
+	health := ConnectionPool.Health()
+	assert.NotNil(t, health.Stats)
+	assert.True(t, health.Live)
+	assert.True(t, health.Ready)
+	assert.Equal(t, Seasoning.PoolConfig.MaxConnectionCount, health.Stats.ConnectionsTotal)
+	assert.Equal(t, health.Stats.ConnectionsTotal, health.Stats.ConnectionsOpen)
+}
+
+func TestRabbitServiceStats(t *testing.T) {
+
+	stats := RabbitService.Stats()
+	assert.Equal(t, uint64(len(Seasoning.ConsumerConfigs)), stats.ConsumersTotal)
+	assert.Equal(t, uint64(0), stats.ConsumersRunning)
+}
+
+func TestReadinessHandler(t *testing.T) {
+
+	notReady := func() *tcr.Health {
+		return &tcr.Health{Live: true, Ready: false, Reason: "no open connections", Stats: &tcr.Stats{}}
+	}
+
+	recorder := httptest.NewRecorder()
+	tcr.ReadinessHandler(notReady).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	tcr.LivenessHandler(notReady).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "no open connections")
+}
@@ -0,0 +1,158 @@
+package main_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/tiggerite/turbocookedrabbit/v2/pkg/tcr"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+
+	order := make([]string, 0)
+	named := func(name string) tcr.Middleware {
+		return func(next tcr.Handler) tcr.Handler {
+			return func(msg *tcr.ReceivedMessage) error {
+				order = append(order, name)
+				return next(msg)
+			}
+		}
+	}
+
+	handler := tcr.Chain(named("first"), named("second"))(func(msg *tcr.ReceivedMessage) error {
+		order = append(order, "handler")
+		return nil
+	})
+
+	assert.NoError(t, handler(tcr.NewReceivedMessage(false, amqp.Delivery{})))
+	assert.Equal(t, []string{"first", "second", "handler"}, order)
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+
+	handler := tcr.Recovery(true)(func(msg *tcr.ReceivedMessage) error {
+		panic("boom")
+	})
+
+	msg := tcr.NewReceivedMessage(true, amqp.Delivery{MessageId: "order-1", Acknowledger: &countingAcknowledger{}})
+	err := handler(msg)
+	assert.True(t, errors.Is(err, tcr.ErrHandlerPanicked))
+	assert.True(t, msg.Settled())
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+
+	handler := tcr.Timeout(10*time.Millisecond, true)(func(msg *tcr.ReceivedMessage) error {
+		<-msg.Context().Done()
+		return nil
+	})
+
+	msg := tcr.NewReceivedMessage(true, amqp.Delivery{Acknowledger: &countingAcknowledger{}})
+	err := handler(msg)
+	assert.True(t, errors.Is(err, tcr.ErrHandlerTimeout))
+	assert.True(t, msg.Settled())
+
+	// Handlers finishing in time are left alone.
+	fast := tcr.Timeout(time.Second, true)(func(msg *tcr.ReceivedMessage) error {
+		return msg.Acknowledge()
+	})
+
+	acknowledger := &countingAcknowledger{}
+	assert.NoError(t, fast(tcr.NewReceivedMessage(true, amqp.Delivery{Acknowledger: acknowledger})))
+	assert.Equal(t, 1, acknowledger.acks)
+}
+
+func TestDecodePayloadMiddleware(t *testing.T) {
+
+	compression := &tcr.CompressionConfig{Enabled: true, Type: tcr.GzipCompressionType}
+	encryption := &tcr.EncryptionConfig{Enabled: true, Type: tcr.AesSymmetricType, Hashkey: make([]byte, 32)}
+
+	payload, err := tcr.CreatePayload("hello", compression, encryption)
+	assert.NoError(t, err)
+
+	var body []byte
+	handler := tcr.DecodePayload(compression, encryption)(func(msg *tcr.ReceivedMessage) error {
+		body = msg.Body
+		return nil
+	})
+
+	assert.NoError(t, handler(tcr.NewReceivedMessage(false, amqp.Delivery{Body: payload})))
+	assert.Equal(t, `"hello"`, string(body))
+
+	// Undecodable payloads are rejected without reaching the handler.
+	body = nil
+	msg := tcr.NewReceivedMessage(true, amqp.Delivery{Body: []byte("garbage"), Acknowledger: &countingAcknowledger{}})
+	assert.Error(t, handler(msg))
+	assert.True(t, msg.Settled())
+	assert.Nil(t, body)
+}
+
+func TestConsumerMiddleware(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	_, _ = RabbitService.Topologer.PurgeQueue("TcrTestQueue", false)
+
+	consumer := tcr.NewConsumerFromConfig(AckableConsumerConfig, ConnectionPool)
+	consumer.UseMiddleware(tcr.Recovery(false))
+	consumer.StartConsumingWithAction(func(msg *tcr.ReceivedMessage) {
+		panic("boom")
+	})
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	assert.NoError(t, publisher.PublishWithConfirmationError(tcr.CreateMockRandomLetter("TcrTestQueue"), time.Second))
+
+	select {
+	case err := <-consumer.Errors():
+		assert.True(t, errors.Is(err, tcr.ErrHandlerPanicked))
+	case <-time.After(5 * time.Second):
+		t.Fatal("test timeout")
+	}
+
+	assert.NoError(t, consumer.StopConsuming(false, true))
+	publisher.Shutdown(false)
+	TestCleanup(t)
+}
+
+func TestConsumerDropsUnreadErrors(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	broker := newFakeBroker(t, nil)
+	broker.DeliverOnConsume(1500)
+
+	pool, err := tcr.NewConnectionPool(&tcr.PoolConfig{
+		URI:                  broker.URI(),
+		Heartbeat:            60,
+		ConnectionTimeout:    10,
+		MaxConnectionCount:   1,
+		MaxCacheChannelCount: 2,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	consumer := tcr.NewConsumerFromConfig(&tcr.ConsumerConfig{
+		Enabled:             true,
+		QueueName:           "TcrTestQueue",
+		ConsumerName:        "TurboCookedRabbitConsumer-Errors",
+		AutoAck:             true,
+		SleepOnIdleInterval: 1,
+	}, pool)
+	consumer.UseMiddleware(func(next tcr.Handler) tcr.Handler {
+		return func(msg *tcr.ReceivedMessage) error {
+			return errors.New("handler failed")
+		}
+	})
+
+	// Nobody reads Errors, the consume loop keeps going once it's full.
+	consumer.StartConsumingWithAction(func(msg *tcr.ReceivedMessage) {})
+	assert.Eventually(t, func() bool { return consumer.DroppedErrors() == 500 }, 15*time.Second, 10*time.Millisecond)
+	assert.Len(t, consumer.Errors(), 1000)
+
+	assert.NoError(t, consumer.StopConsuming(true, true))
+	pool.Shutdown()
+	broker.Close()
+}
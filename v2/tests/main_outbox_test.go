@@ -0,0 +1,156 @@
+package main_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tiggerite/turbocookedrabbit/v2/pkg/tcr"
+)
+
+func TestFileOutboxStore(t *testing.T) {
+
+	directory := t.TempDir()
+	store, err := tcr.NewFileOutboxStore(directory)
+	assert.NoError(t, err)
+
+	first := tcr.CreateMockRandomLetter("TcrTestQueue")
+	second := tcr.CreateMockRandomLetter("TcrTestQueue")
+	assert.NoError(t, store.Insert(first))
+	assert.NoError(t, store.Insert(second))
+
+	unsent, err := store.Unsent(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(unsent))
+	assert.Equal(t, first.LetterID, unsent[0].LetterID)
+
+	// Unsent letters are returned again until marked sent.
+	assert.NoError(t, store.MarkSent(context.Background(), first.LetterID))
+	assert.NoError(t, store.Close())
+
+	store, err = tcr.NewFileOutboxStore(directory)
+	assert.NoError(t, err)
+	defer store.Close()
+
+	unsent, err = store.Unsent(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(unsent))
+	assert.Equal(t, second.LetterID, unsent[0].LetterID)
+}
+
+func TestCreateSQLOutboxStoreWithInvalidConfig(t *testing.T) {
+
+	_, err := tcr.NewSQLOutboxStore(nil, &tcr.OutboxConfig{TableName: "outbox; DROP TABLE users"})
+	assert.Error(t, err)
+
+	_, err = tcr.NewSQLOutboxStore(nil, &tcr.OutboxConfig{PlaceholderStyle: ":"})
+	assert.Error(t, err)
+
+	_, err = tcr.NewSQLOutboxStore(nil, &tcr.OutboxConfig{TableName: "app.outbox", PlaceholderStyle: "$"})
+	assert.NoError(t, err)
+}
+
+func TestSQLOutboxStore(t *testing.T) {
+
+	for _, placeholder := range []string{"?", "$"} {
+		db, database := newFakeOutboxDB("app.outbox", placeholder)
+
+		store, err := tcr.NewSQLOutboxStore(db, &tcr.OutboxConfig{TableName: "app.outbox", PlaceholderStyle: placeholder})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		ctx := context.Background()
+		assert.NoError(t, store.CreateTable(ctx))
+
+		first := tcr.CreateMockRandomLetter("TcrTestQueue")
+		second := tcr.CreateMockRandomLetter("TcrTestQueue")
+		third := tcr.CreateMockRandomLetter("TcrTestQueue")
+
+		// Letters inserted in a transaction are only claimed once it commits.
+		tx, err := db.BeginTx(ctx, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NoError(t, store.Insert(ctx, tx, first))
+		assert.NoError(t, store.Insert(ctx, tx, second))
+
+		unsent, err := store.Unsent(ctx, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(unsent))
+
+		assert.NoError(t, tx.Commit())
+
+		// A rolled back transaction discards its letters.
+		tx, err = db.BeginTx(ctx, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NoError(t, store.Insert(ctx, tx, third))
+		assert.NoError(t, tx.Rollback())
+
+		unsent, err = store.Unsent(ctx, 10)
+		assert.NoError(t, err)
+		if !assert.Equal(t, 2, len(unsent)) {
+			return
+		}
+		assert.Equal(t, first.LetterID, unsent[0].LetterID)
+		assert.Equal(t, first.Body, unsent[0].Body)
+		assert.Equal(t, second.LetterID, unsent[1].LetterID)
+
+		unsent, err = store.Unsent(ctx, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(unsent))
+
+		// Letters marked sent are no longer claimed, and purged once old enough.
+		assert.NoError(t, store.MarkSent(ctx, first.LetterID))
+
+		unsent, err = store.Unsent(ctx, 10)
+		assert.NoError(t, err)
+		if assert.Equal(t, 1, len(unsent)) {
+			assert.Equal(t, second.LetterID, unsent[0].LetterID)
+		}
+
+		purged, err := store.PurgeSent(ctx, time.Now().Add(-time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), purged)
+
+		purged, err = store.PurgeSent(ctx, time.Now().Add(time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), purged)
+
+		rows := database.Rows()
+		if assert.Equal(t, 1, len(rows)) {
+			assert.Equal(t, second.LetterID.String(), rows[0].LetterID)
+			assert.Nil(t, rows[0].SentAt)
+		}
+
+		assert.NoError(t, db.Close())
+	}
+}
+
+func TestOutboxRelay(t *testing.T) {
+
+	store, err := tcr.NewFileOutboxStore(t.TempDir())
+	assert.NoError(t, err)
+	defer store.Close()
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, store.Insert(tcr.CreateMockRandomLetter("TcrTestQueue")))
+	}
+
+	relay := tcr.NewOutboxRelay(RabbitService.Publisher, store, &tcr.OutboxConfig{BatchSize: 5})
+
+	count, err := relay.Relay(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 5, count)
+
+	count, err = relay.Relay(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 5, count)
+
+	unsent, err := store.Unsent(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(unsent))
+}
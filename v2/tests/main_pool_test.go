@@ -147,3 +147,61 @@ func TestConnectionGetConnectionAndReturnSlowLoop(t *testing.T) {
 	wg.Wait()
 	TestCleanup(t)
 }
+
+func TestCreateElasticConnectionPoolAndGetChannels(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	config := *Seasoning.PoolConfig
+	config.MaxConnectionCount = 2
+	config.MinCacheChannelCount = 1
+	config.MaxCacheChannelCount = 4
+
+	cp, err := tcr.NewConnectionPool(&config)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), cp.Stats().ChannelsIdle)
+
+	chanHosts := make([]*tcr.ChannelHost, 0)
+	for i := 0; i < 3; i++ {
+		chanHosts = append(chanHosts, cp.GetChannelFromPool()) // grows on demand
+	}
+
+	stats := cp.Stats()
+	assert.Equal(t, uint64(3), stats.ChannelsInUse)
+	assert.Equal(t, uint64(0), stats.ChannelsIdle)
+	assert.NotEqual(t, chanHosts[0].ConnectionID, chanHosts[1].ConnectionID) // least loaded connection
+
+	for _, chanHost := range chanHosts {
+		cp.ReturnChannel(chanHost, false)
+	}
+
+	assert.Equal(t, uint64(3), cp.Stats().ChannelsIdle)
+
+	cp.Shutdown()
+	TestCleanup(t)
+}
+
+func TestCreateConnectionPoolAndGetNonConfirmChannel(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	config := *Seasoning.PoolConfig
+	config.MaxConnectionCount = 1
+	config.MaxCacheNonConfirmChannelCount = 2
+
+	cp, err := tcr.NewConnectionPool(&config)
+	assert.NoError(t, err)
+
+	chanHost := cp.GetNonConfirmChannelFromPool()
+	assert.NotNil(t, chanHost)
+	assert.False(t, chanHost.Ackable)
+	assert.True(t, chanHost.CachedChannel)
+
+	cp.ReturnChannel(chanHost, false)
+
+	ackableChanHost := cp.GetChannelFromPool()
+	assert.True(t, ackableChanHost.Ackable)
+
+	cp.ReturnChannel(ackableChanHost, false)
+
+	cp.Shutdown()
+	TestCleanup(t)
+}
@@ -1,7 +1,10 @@
 package main_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -238,3 +241,295 @@ WaitLoop:
 
 	TestCleanup(t)
 }
+
+func TestPublishAsync(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	var completed int32
+	futures := make([]*tcr.PublishFuture, 0)
+	for i := 0; i < 100; i++ {
+		future := publisher.PublishAsync(ctx, tcr.CreateMockRandomLetter("TcrTestQueue"))
+		future.OnComplete(func(receipt *tcr.PublishReceipt) { atomic.AddInt32(&completed, 1) })
+		futures = append(futures, future)
+	}
+
+	for _, future := range futures {
+		assert.NoError(t, future.Wait())
+		assert.True(t, future.Receipt().Success)
+	}
+
+	assert.Equal(t, int32(100), atomic.LoadInt32(&completed))
+
+	// Unroutable mandatory letters resolve as returned.
+	letter := tcr.CreateMockRandomLetter("TcrNonExistentQueue")
+	letter.Envelope.Mandatory = true
+
+	future := publisher.PublishAsync(ctx, letter)
+	<-future.Done()
+	assert.True(t, errors.Is(future.Receipt().Error, tcr.ErrPublishReturned))
+	assert.NotNil(t, future.Receipt().Returned)
+
+	publisher.Shutdown(false)
+	TestCleanup(t)
+}
+
+func TestPublishAsyncReturnedWithCustomMessageID(t *testing.T) {
+
+	broker := newFakeBroker(t, nil)
+	broker.ConfirmPublishes()
+	broker.ReturnMandatory()
+
+	pool, err := tcr.NewConnectionPool(&tcr.PoolConfig{
+		URI:                  broker.URI(),
+		Heartbeat:            60,
+		ConnectionTimeout:    10,
+		MaxConnectionCount:   1,
+		MaxCacheChannelCount: 2,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer pool.Shutdown()
+
+	publisher := tcr.NewPublisherFromConfig(&tcr.RabbitSeasoning{
+		PublisherConfig: &tcr.PublisherConfig{PublishTimeOutInterval: 5000},
+	}, pool)
+	defer publisher.Shutdown(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	routed := tcr.CreateMockRandomLetter("TcrTestQueue")
+	routed.Envelope.MessageID = "custom-message-id"
+
+	letter := tcr.CreateMockRandomLetter("TcrNonExistentQueue")
+	letter.Envelope.MessageID = "custom-message-id"
+	letter.Envelope.Mandatory = true
+
+	// Only the mandatory letter is returned, despite sharing its MessageID with the letter before it.
+	routedFuture := publisher.PublishAsync(ctx, routed)
+	future := publisher.PublishAsync(ctx, letter)
+
+	assert.NoError(t, routedFuture.Wait())
+
+	err = future.Wait()
+	assert.True(t, errors.Is(err, tcr.ErrPublishReturned), "unexpected error: %v", err)
+	if assert.NotNil(t, future.Receipt().Returned) {
+		assert.Equal(t, "custom-message-id", future.Receipt().Returned.MessageId)
+		assert.Equal(t, "TcrNonExistentQueue", future.Receipt().Returned.RoutingKey)
+	}
+}
+
+func TestPublishAsyncShutdownWithoutChannel(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	broker := newFakeBroker(t, nil)
+
+	pool, err := tcr.NewConnectionPool(&tcr.PoolConfig{
+		URI:                  broker.URI(),
+		Heartbeat:            60,
+		ConnectionTimeout:    10,
+		MaxConnectionCount:   1,
+		MaxCacheChannelCount: 1,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Holding the only connection keeps the async publishing loop waiting on a channel, as while the broker is down.
+	connHost, err := pool.GetConnection()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	seasoning := &tcr.RabbitSeasoning{PublisherConfig: &tcr.PublisherConfig{PublishTimeOutInterval: 5000}}
+
+	// ShutdownContext gives up on the context.
+	publisher := tcr.NewPublisherFromConfig(seasoning, pool)
+	future := publisher.PublishAsync(context.Background(), tcr.CreateMockRandomLetter("TcrTestQueue"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	undelivered, err := publisher.ShutdownContext(ctx)
+	cancel()
+	assert.Error(t, err)
+	assert.Len(t, undelivered, 1)
+	assert.ErrorIs(t, future.Wait(), context.DeadlineExceeded)
+
+	// Shutdown fails the letters waiting to be published.
+	publisher = tcr.NewPublisherFromConfig(seasoning, pool)
+	future = publisher.PublishAsync(context.Background(), tcr.CreateMockRandomLetter("TcrTestQueue"))
+
+	stopped := make(chan struct{})
+	go func() {
+		publisher.Shutdown(false)
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown hung waiting on a channel")
+	}
+	assert.ErrorIs(t, future.Wait(), tcr.ErrPublisherShutdown)
+
+	// The channels acquired once the connection is back are closed, neither loop needs them anymore.
+	pool.ReturnConnection(connHost, false)
+	assert.Eventually(t, func() bool { return broker.ChannelCloses() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	pool.Shutdown()
+	broker.Close()
+}
+
+func TestPublisherDropsUnreadReceipts(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	broker := newFakeBroker(t, nil)
+
+	pool, err := tcr.NewConnectionPool(&tcr.PoolConfig{
+		URI:                  broker.URI(),
+		Heartbeat:            60,
+		ConnectionTimeout:    10,
+		MaxConnectionCount:   1,
+		MaxCacheChannelCount: 1,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Nobody reads PublishReceipts, publishing keeps going once it's full.
+	publisher := tcr.NewPublisherFromConfig(&tcr.RabbitSeasoning{PublisherConfig: &tcr.PublisherConfig{}}, pool)
+	for i := 0; i < 1010; i++ {
+		publisher.Publish(tcr.CreateMockRandomLetter("TcrTestQueue"), false)
+	}
+
+	assert.Len(t, publisher.PublishReceipts(), 1000)
+	assert.Equal(t, uint64(10), publisher.DroppedReceipts())
+
+	publisher.Shutdown(false)
+	pool.Shutdown()
+	broker.Close()
+}
+
+func TestPublisherShutdownContextReturnsBufferedLetters(t *testing.T) {
+
+	publisher := tcr.NewPublisher(nil, 0, 0, 0)
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, publisher.QueueLetter(tcr.CreateMockRandomLetter("TcrTestQueue")))
+	}
+
+	// Without auto-publishing, nothing delivers the buffered letters.
+	undelivered, err := publisher.ShutdownContext(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, 3, len(undelivered))
+
+	assert.False(t, publisher.QueueLetter(tcr.CreateMockRandomLetter("TcrTestQueue")))
+	assert.Error(t, publisher.PublishAsync(context.Background(), tcr.CreateMockRandomLetter("TcrTestQueue")).Wait())
+}
+
+func TestPublisherShutdownContextAndRestart(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	publisher.StartAutoPublishing()
+
+	for i := 0; i < 100; i++ {
+		assert.True(t, publisher.QueueLetter(tcr.CreateMockRandomLetter("TcrTestQueue")))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	undelivered, err := publisher.ShutdownContext(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(undelivered))
+
+	// Intake is re-opened by starting again.
+	publisher.StartAutoPublishing()
+	assert.True(t, publisher.QueueLetter(tcr.CreateMockRandomLetter("TcrTestQueue")))
+
+	undelivered, err = publisher.ShutdownContext(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(undelivered))
+
+	TestCleanup(t)
+}
+
+func TestPublisherRestartAfterRepeatedShutdown(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	broker := newFakeBroker(t, nil)
+	broker.ConfirmPublishes()
+
+	pool, err := tcr.NewConnectionPool(&tcr.PoolConfig{
+		URI:                  broker.URI(),
+		Heartbeat:            60,
+		ConnectionTimeout:    10,
+		MaxConnectionCount:   1,
+		MaxCacheChannelCount: 2,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	publisher := tcr.NewPublisherFromConfig(&tcr.RabbitSeasoning{
+		PublisherConfig: &tcr.PublisherConfig{SleepOnIdleInterval: 10, PublishTimeOutInterval: 5000},
+	}, pool)
+
+	publisher.StartAutoPublishing()
+	publisher.Shutdown(false)
+	publisher.Shutdown(false)
+	time.Sleep(50 * time.Millisecond) // let the first run stop
+
+	// A stop meant for the first run doesn't stop the next one.
+	publisher.StartAutoPublishing()
+	assert.True(t, publisher.QueueLetter(tcr.CreateMockRandomLetter("TcrTestQueue")))
+	assert.Eventually(t, func() bool { return broker.Publishes() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	publisher.Shutdown(false)
+	pool.Shutdown()
+	broker.Close()
+}
+
+func TestQueueLetterWithPriorityLaneStats(t *testing.T) {
+
+	config := &tcr.RabbitSeasoning{
+		PublisherConfig: &tcr.PublisherConfig{
+			HighPriorityLane: &tcr.LaneConfig{Weight: 10, Capacity: 5},
+		},
+	}
+
+	publisher := tcr.NewPublisherFromConfig(config, nil)
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, publisher.QueueLetterWithPriority(tcr.CreateMockRandomLetter("TcrTestQueue"), tcr.PriorityHigh))
+	}
+	assert.True(t, publisher.QueueLetterWithPriority(tcr.CreateMockRandomLetter("TcrTestQueue"), tcr.PriorityLow))
+	assert.True(t, publisher.QueueLetter(tcr.CreateMockRandomLetter("TcrTestQueue")))
+
+	stats := publisher.LaneStats()
+	assert.Equal(t, 3, len(stats))
+
+	assert.Equal(t, tcr.PriorityHigh, stats[0].Priority)
+	assert.Equal(t, uint32(10), stats[0].Weight)
+	assert.Equal(t, 5, stats[0].Capacity)
+	assert.Equal(t, 3, stats[0].Queued)
+	assert.Equal(t, uint64(3), stats[0].Enqueued)
+
+	assert.Equal(t, tcr.PriorityNormal, stats[1].Priority)
+	assert.Equal(t, 1000, stats[1].Capacity)
+	assert.Equal(t, 1, stats[1].Queued)
+
+	assert.Equal(t, tcr.PriorityLow, stats[2].Priority)
+	assert.Equal(t, uint32(1), stats[2].Weight)
+	assert.Equal(t, 1, stats[2].Queued)
+
+	undelivered, err := publisher.ShutdownContext(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, 5, len(undelivered))
+}
@@ -0,0 +1,76 @@
+package main_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tiggerite/turbocookedrabbit/v2/pkg/tcr"
+)
+
+func TestRateLimiterFailFast(t *testing.T) {
+
+	limiter := tcr.NewRateLimiter(&tcr.RateLimitConfig{
+		MessagesPerSecond: 5,
+		FailFast:          true,
+	})
+
+	// The burst is one second worth of messages.
+	for i := 0; i < 5; i++ {
+		release, err := limiter.Acquire(context.Background(), 10)
+		assert.NoError(t, err)
+		release()
+	}
+
+	_, err := limiter.Acquire(context.Background(), 10)
+	assert.ErrorIs(t, err, tcr.ErrRateLimited)
+}
+
+func TestRateLimiterMaxInFlight(t *testing.T) {
+
+	limiter := tcr.NewRateLimiter(&tcr.RateLimitConfig{
+		MaxInFlight: 2,
+		FailFast:    true,
+	})
+
+	first, err := limiter.Acquire(context.Background(), 0)
+	assert.NoError(t, err)
+	_, err = limiter.Acquire(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, limiter.InFlight())
+
+	_, err = limiter.Acquire(context.Background(), 0)
+	assert.ErrorIs(t, err, tcr.ErrRateLimited)
+
+	// Releasing twice only frees the one slot.
+	first()
+	first()
+	assert.Equal(t, 1, limiter.InFlight())
+
+	_, err = limiter.Acquire(context.Background(), 0)
+	assert.NoError(t, err)
+}
+
+func TestRateLimiterBlocking(t *testing.T) {
+
+	limiter := tcr.NewRateLimiter(&tcr.RateLimitConfig{
+		BytesPerSecond: 1000,
+	})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		release, err := limiter.Acquire(context.Background(), 500)
+		assert.NoError(t, err)
+		release()
+	}
+
+	// 1000 bytes of burst, the last 500 bytes wait half a second.
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*400)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	_, err := limiter.Acquire(ctx, 5000)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,99 @@
+package main_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/tiggerite/turbocookedrabbit/v2/pkg/tcr"
+)
+
+func TestNewRPCReply(t *testing.T) {
+
+	request := tcr.NewReceivedMessage(false, amqp.Delivery{
+		ReplyTo:       tcr.DirectReplyTo,
+		CorrelationId: "CorrelationID",
+		ContentType:   "application/json",
+	})
+
+	reply := tcr.NewRPCReply(request, []byte("{}"), nil)
+	assert.Equal(t, "", reply.Envelope.Exchange)
+	assert.Equal(t, tcr.DirectReplyTo, reply.Envelope.RoutingKey)
+	assert.Equal(t, "CorrelationID", reply.Envelope.CorrelationID)
+	assert.Equal(t, "application/json", reply.Envelope.ContentType)
+	assert.Equal(t, []byte("{}"), reply.Body)
+	assert.NotContains(t, reply.Envelope.Headers, tcr.RPCErrorHeader)
+
+	reply = tcr.NewRPCReply(request, []byte("{}"), errors.New("not found"))
+	assert.Equal(t, "not found", reply.Envelope.Headers[tcr.RPCErrorHeader])
+	assert.Empty(t, reply.Body)
+}
+
+func TestRPCReturnedRequestFailsFast(t *testing.T) {
+
+	broker := newFakeBroker(t, nil)
+	broker.ReturnMandatory()
+
+	pool, err := tcr.NewConnectionPool(&tcr.PoolConfig{
+		URI:                  broker.URI(),
+		Heartbeat:            60,
+		ConnectionTimeout:    10,
+		MaxConnectionCount:   1,
+		MaxCacheChannelCount: 2,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer pool.Shutdown()
+
+	publisher := tcr.NewPublisherFromConfig(&tcr.RabbitSeasoning{PublisherConfig: &tcr.PublisherConfig{}}, pool)
+	client := tcr.NewRPCClient(publisher, &tcr.RPCConfig{Timeout: 10000})
+	defer client.Close()
+
+	letter := tcr.CreateMockLetter("", "TcrNonExistentQueue", []byte("ping"))
+	letter.Envelope.Mandatory = true
+
+	started := time.Now()
+	_, err = client.Call(context.Background(), letter)
+	assert.ErrorIs(t, err, tcr.ErrPublishReturned)
+
+	_, err = client.ScatterGather(context.Background(), letter, &tcr.GatherOptions{Quorum: 1})
+	assert.ErrorIs(t, err, tcr.ErrPublishReturned)
+
+	assert.Less(t, time.Since(started), 5*time.Second)
+}
+
+func TestRPCCall(t *testing.T) {
+
+	consumer := tcr.NewConsumerFromConfig(AckableConsumerConfig, ConnectionPool)
+	consumer.StartRPCServer(RabbitService.Publisher, func(request *tcr.ReceivedMessage) ([]byte, error) {
+		if len(request.Body) == 0 {
+			return nil, errors.New("empty request")
+		}
+		return append([]byte("echo: "), request.Body...), nil
+	})
+	defer func() { _ = consumer.StopConsuming(false, true) }()
+
+	for _, private := range []bool{false, true} {
+		client := tcr.NewRPCClient(RabbitService.Publisher, &tcr.RPCConfig{PrivateReplyQueue: private, Timeout: 5000})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		reply, err := client.Call(ctx, tcr.CreateMockLetter("", "TcrTestQueue", []byte("ping")))
+		assert.NoError(t, err)
+		if assert.NotNil(t, reply) {
+			assert.Equal(t, []byte("echo: ping"), reply.Body)
+		}
+
+		_, err = client.Call(ctx, tcr.CreateMockLetter("", "TcrTestQueue", []byte{}))
+		assert.ErrorIs(t, err, tcr.ErrRPCRemote)
+
+		cancel()
+		client.Close()
+
+		_, err = client.Call(context.Background(), tcr.CreateMockLetter("", "TcrTestQueue", []byte("ping")))
+		assert.ErrorIs(t, err, tcr.ErrRPCClientClosed)
+	}
+}
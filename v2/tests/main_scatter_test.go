@@ -0,0 +1,93 @@
+package main_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tiggerite/turbocookedrabbit/v2/pkg/tcr"
+)
+
+func TestScatterGather(t *testing.T) {
+
+	exchangeName := "TcrScatterExchange"
+	assert.NoError(t, RabbitService.Topologer.CreateExchange(exchangeName, "fanout", false, false, true, false, false, nil))
+	defer func() { _ = RabbitService.Topologer.ExchangeDelete(exchangeName, false, false) }()
+
+	for i := 0; i < 3; i++ {
+		queueName := fmt.Sprintf("TcrScatterQueue%d", i)
+		assert.NoError(t, RabbitService.Topologer.CreateQueue(queueName, false, false, true, false, false, nil))
+		assert.NoError(t, RabbitService.Topologer.QueueBind(&tcr.QueueBinding{QueueName: queueName, ExchangeName: exchangeName}))
+		defer func() { _, _ = RabbitService.Topologer.QueueDelete(queueName, false, false, false) }()
+
+		region := i
+		consumer := tcr.NewConsumerFromConfig(AckableConsumerConfig, ConnectionPool)
+		consumer.QueueName = queueName
+		consumer.StartRPCServer(RabbitService.Publisher, func(request *tcr.ReceivedMessage) ([]byte, error) {
+			if region == 2 {
+				return nil, errors.New("out of stock")
+			}
+			return []byte(fmt.Sprintf("region %d", region)), nil
+		})
+		defer func() { _ = consumer.StopConsuming(false, true) }()
+	}
+
+	client := tcr.NewRPCClient(RabbitService.Publisher, &tcr.RPCConfig{Timeout: 2000})
+	defer client.Close()
+
+	// Stops as soon as the count is reached.
+	replies, err := client.ScatterGather(context.Background(), tcr.CreateMockLetter(exchangeName, "", []byte("price?")), &tcr.GatherOptions{Count: 2})
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, len(replies), 2)
+
+	// Stops as soon as the quorum is reached, well ahead of the deadline.
+	started := time.Now()
+	replies, err = client.ScatterGather(context.Background(), tcr.CreateMockLetter(exchangeName, "", []byte("price?")), &tcr.GatherOptions{Quorum: 2})
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, len(replies), 2)
+	assert.Less(t, time.Since(started), time.Second)
+
+	// Waits for the deadline, the failed responder doesn't count towards the quorum.
+	replies, err = client.ScatterGather(context.Background(), tcr.CreateMockLetter(exchangeName, "", []byte("price?")), &tcr.GatherOptions{Quorum: 3})
+	assert.ErrorIs(t, err, tcr.ErrQuorumNotReached)
+	assert.Len(t, replies, 3)
+}
+
+func TestScatterGatherCanceled(t *testing.T) {
+
+	broker := newFakeBroker(t, nil) // never replies
+
+	pool, err := tcr.NewConnectionPool(&tcr.PoolConfig{
+		URI:                  broker.URI(),
+		Heartbeat:            60,
+		ConnectionTimeout:    10,
+		MaxConnectionCount:   1,
+		MaxCacheChannelCount: 2,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer pool.Shutdown()
+
+	publisher := tcr.NewPublisherFromConfig(&tcr.RabbitSeasoning{PublisherConfig: &tcr.PublisherConfig{}}, pool)
+	client := tcr.NewRPCClient(publisher, &tcr.RPCConfig{Timeout: 50})
+	defer client.Close()
+
+	// The deadline passing without a quorum isn't an error.
+	replies, err := client.ScatterGather(context.Background(), tcr.CreateMockLetter("TcrScatterExchange", "", []byte("price?")), nil)
+	assert.NoError(t, err)
+	assert.Empty(t, replies)
+
+	// The caller canceling is.
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	client = tcr.NewRPCClient(publisher, &tcr.RPCConfig{Timeout: 10000})
+	defer client.Close()
+
+	_, err = client.ScatterGather(ctx, tcr.CreateMockLetter("TcrScatterExchange", "", []byte("price?")), nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,270 @@
+package main_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tiggerite/turbocookedrabbit/v2/pkg/tcr"
+)
+
+func TestSpoolReplaysPendingLettersInOrder(t *testing.T) {
+
+	config := &tcr.SpoolConfig{
+		Enabled:   true,
+		Directory: t.TempDir(),
+	}
+
+	spool, err := tcr.NewSpool(config)
+	assert.NoError(t, err)
+
+	letters := make([]*tcr.Letter, 0)
+	for i := 0; i < 10; i++ {
+		letter := tcr.CreateMockRandomLetter("TcrTestQueue")
+		letters = append(letters, letter)
+		assert.NoError(t, spool.Append(letter))
+	}
+
+	// Confirm the first half.
+	for i := 0; i < 5; i++ {
+		letter, ok := spool.Dequeue()
+		assert.True(t, ok)
+		assert.Equal(t, letters[i].LetterID, letter.LetterID)
+		assert.NoError(t, spool.Ack(letter.LetterID))
+	}
+
+	assert.Equal(t, 5, spool.Pending())
+	assert.NoError(t, spool.Close())
+
+	spool, err = tcr.NewSpool(config)
+	assert.NoError(t, err)
+	defer spool.Close()
+
+	assert.Equal(t, 5, spool.Pending())
+	assert.Equal(t, 5, spool.Queued())
+
+	for i := 5; i < 10; i++ {
+		letter, ok := spool.Dequeue()
+		assert.True(t, ok)
+		assert.Equal(t, letters[i].LetterID, letter.LetterID)
+		assert.Equal(t, letters[i].Body, letter.Body)
+	}
+
+	_, ok := spool.Dequeue()
+	assert.False(t, ok)
+}
+
+func TestSpoolReplaysLetterAppendedAgainAfterAckOnce(t *testing.T) {
+
+	config := &tcr.SpoolConfig{
+		Enabled:   true,
+		Directory: t.TempDir(),
+	}
+
+	spool, err := tcr.NewSpool(config)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	letter := tcr.CreateMockRandomLetter("TcrTestQueue")
+	assert.NoError(t, spool.Append(letter))
+	_, ok := spool.Dequeue()
+	assert.True(t, ok)
+	assert.NoError(t, spool.Ack(letter.LetterID))
+	assert.NoError(t, spool.Append(letter))
+	assert.NoError(t, spool.Close())
+
+	spool, err = tcr.NewSpool(config)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer spool.Close()
+
+	assert.Equal(t, 1, spool.Pending())
+	assert.Equal(t, 1, spool.Queued())
+
+	replayed, ok := spool.Dequeue()
+	assert.True(t, ok)
+	assert.Equal(t, letter.LetterID, replayed.LetterID)
+
+	_, ok = spool.Dequeue()
+	assert.False(t, ok)
+}
+
+func TestSpoolRequeueAndSegmentRollover(t *testing.T) {
+
+	config := &tcr.SpoolConfig{
+		Enabled:        true,
+		Directory:      t.TempDir(),
+		MaxSegmentSize: 512,
+		RetryBackoff:   20,
+	}
+
+	spool, err := tcr.NewSpool(config)
+	assert.NoError(t, err)
+	defer spool.Close()
+
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, spool.Append(tcr.CreateMockRandomLetter("TcrTestQueue")))
+	}
+
+	segments, _ := filepath.Glob(filepath.Join(config.Directory, "*.spool"))
+	assert.Greater(t, len(segments), 1)
+
+	// A failed publish goes back to the front of the queue, holding back the others until its backoff passed.
+	first, _ := spool.Dequeue()
+	assert.True(t, spool.Requeue(first.LetterID))
+	_, ok := spool.Dequeue()
+	assert.False(t, ok)
+
+	var letter *tcr.Letter
+	assert.Eventually(t, func() bool {
+		letter, ok = spool.Dequeue()
+		return ok
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, first.LetterID, letter.LetterID)
+	assert.NoError(t, spool.Ack(letter.LetterID))
+
+	for {
+		letter, ok := spool.Dequeue()
+		if !ok {
+			break
+		}
+		assert.NoError(t, spool.Ack(letter.LetterID))
+	}
+
+	assert.Equal(t, 0, spool.Pending())
+
+	// Fully acked segments are removed, only the active one is left.
+	segments, _ = filepath.Glob(filepath.Join(config.Directory, "*.spool"))
+	assert.Equal(t, 1, len(segments))
+}
+
+func TestSpoolTruncatesTornRecord(t *testing.T) {
+
+	config := &tcr.SpoolConfig{
+		Enabled:   true,
+		Directory: t.TempDir(),
+	}
+
+	spool, err := tcr.NewSpool(config)
+	assert.NoError(t, err)
+
+	letter := tcr.CreateMockRandomLetter("TcrTestQueue")
+	assert.NoError(t, spool.Append(letter))
+	assert.NoError(t, spool.Close())
+
+	// Simulate a crash halfway through writing the next record.
+	segments, _ := filepath.Glob(filepath.Join(config.Directory, "*.spool"))
+	file, err := os.OpenFile(segments[len(segments)-1], os.O_WRONLY|os.O_APPEND, 0600)
+	assert.NoError(t, err)
+	_, err = file.Write([]byte{1, 0, 0, 1, 0, '{'})
+	assert.NoError(t, err)
+	file.Close()
+
+	spool, err = tcr.NewSpool(config)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, spool.Pending())
+	replayed, ok := spool.Dequeue()
+	assert.True(t, ok)
+	assert.Equal(t, letter.LetterID, replayed.LetterID)
+
+	// Writes after the truncated record survive the next replay.
+	second := tcr.CreateMockRandomLetter("TcrTestQueue")
+	assert.NoError(t, spool.Append(second))
+	assert.NoError(t, spool.Close())
+
+	spool, err = tcr.NewSpool(config)
+	assert.NoError(t, err)
+	defer spool.Close()
+
+	assert.Equal(t, 2, spool.Pending())
+}
+
+func TestSpoolDropsExhaustedLetters(t *testing.T) {
+
+	spool, err := tcr.NewSpool(&tcr.SpoolConfig{
+		Enabled:      true,
+		Directory:    t.TempDir(),
+		MaxAttempts:  2,
+		RetryBackoff: 1,
+	})
+	assert.NoError(t, err)
+	defer spool.Close()
+
+	failing := tcr.CreateMockRandomLetter("TcrTestQueue")
+	assert.NoError(t, spool.Append(failing))
+	assert.NoError(t, spool.Append(tcr.CreateMockRandomLetter("TcrTestQueue")))
+
+	letter, _ := spool.Dequeue()
+	assert.True(t, spool.Requeue(letter.LetterID))
+
+	assert.Eventually(t, func() bool {
+		letter, _ = spool.Dequeue()
+		return letter != nil
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, failing.LetterID, letter.LetterID)
+
+	// Out of attempts, the letter is dropped and the next one is handed out.
+	assert.False(t, spool.Requeue(letter.LetterID))
+	assert.Equal(t, 1, spool.Pending())
+
+	next, ok := spool.Dequeue()
+	assert.True(t, ok)
+	assert.NotEqual(t, failing.LetterID, next.LetterID)
+}
+
+func TestSpooledLetterFailsWithOneReceipt(t *testing.T) {
+
+	broker := newFakeBroker(t, nil) // never confirms
+
+	pool, err := tcr.NewConnectionPool(&tcr.PoolConfig{
+		URI:                  broker.URI(),
+		Heartbeat:            60,
+		ConnectionTimeout:    10,
+		MaxConnectionCount:   1,
+		MaxCacheChannelCount: 2,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer pool.Shutdown()
+
+	spool, err := tcr.NewSpool(&tcr.SpoolConfig{
+		Enabled:      true,
+		Directory:    t.TempDir(),
+		MaxAttempts:  3,
+		RetryBackoff: 10,
+	})
+	assert.NoError(t, err)
+	defer spool.Close()
+
+	publisher := tcr.NewPublisherFromConfig(&tcr.RabbitSeasoning{
+		PublisherConfig: &tcr.PublisherConfig{PublishTimeOutInterval: 50},
+	}, pool)
+	publisher.UseSpool(spool)
+	publisher.StartAutoPublishing()
+	defer publisher.Shutdown(false)
+
+	assert.True(t, publisher.QueueLetter(tcr.CreateMockRandomLetter("TcrTestQueue")))
+
+	select {
+	case receipt := <-publisher.PublishReceipts():
+		assert.False(t, receipt.Success)
+		assert.Error(t, receipt.Error)
+	case <-time.After(5 * time.Second):
+		t.Fatal("test timeout")
+	}
+
+	assert.Eventually(t, func() bool { return broker.Publishes() == 3 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, spool.Pending())
+
+	select {
+	case <-publisher.PublishReceipts():
+		t.Fatal("received a second receipt for the letter")
+	case <-time.After(200 * time.Millisecond):
+	}
+}